@@ -0,0 +1,195 @@
+// Package api serves a JSON HTTP API to inspect and control the worker remotely
+//
+// Every request must be authenticated with the "api.token" setting, sent as "Authorization: Bearer <token>".
+//
+// Endpoints:
+//   - GET /status : Engine statistics, thread usage, paused process types and drain state
+//   - GET /jobs : Jobs running on this worker with PID, signature, start time and elapsed seconds
+//   - POST /jobs/<signature>/cancel[?queue=<queue>] : Kills a running job, which is then recorded as cancelled
+//   - POST /pause/<type> and POST /resume/<type> : Pauses or resumes dispatching jobs of a process type (pending, update, maintenance)
+//   - GET /quarantine : Jobs excluded from processing after repeated failures, across all workers
+//   - POST /quarantine/<signature>/release[?queue=<queue>] : Releases a quarantined job so that it is processed again,
+//     the default queue when no queue is given
+//   - POST /lookup : Runs a lookup for new jobs immediately
+//   - POST /maintenance : Runs a maintenance job on the next lookup, regardless of its idle time
+//   - POST /drain : Stops dispatching new jobs, waits for the running ones and shuts the worker down
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"query-queue-worker/config"
+	"query-queue-worker/engine"
+	"query-queue-worker/engine/threads"
+	"query-queue-worker/log"
+	"query-queue-worker/os"
+	"query-queue-worker/types"
+	"query-queue-worker/util"
+	"strings"
+)
+
+// Initializes package, starting the HTTP listener when the API is enabled
+func Init() {
+	if !config.Settings.Api.Enabled {
+		return
+	}
+	if config.Settings.Api.Token == "" {
+		util.Die("Error: api.token is required when the API is enabled")
+	}
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/status", handle(http.MethodGet, status))
+	mux.HandleFunc("/jobs", handle(http.MethodGet, jobs))
+	mux.HandleFunc("/jobs/", handle(http.MethodPost, cancel))
+	mux.HandleFunc("/pause/", handle(http.MethodPost, pause))
+	mux.HandleFunc("/resume/", handle(http.MethodPost, resume))
+	mux.HandleFunc("/quarantine", handle(http.MethodGet, quarantine))
+	mux.HandleFunc("/quarantine/", handle(http.MethodPost, release))
+	mux.HandleFunc("/lookup", handle(http.MethodPost, lookup))
+	mux.HandleFunc("/maintenance", handle(http.MethodPost, maintenance))
+	mux.HandleFunc("/drain", handle(http.MethodPost, drain))
+	go func() {
+		log.Writer.Infof("Serving admin API on %s", config.Settings.Api.Address)
+		err := http.ListenAndServe(config.Settings.Api.Address, mux)
+		if err != nil {
+			log.Writer.Errorf("Admin API listener stopped: %v", err.Error())
+		}
+	}()
+}
+
+// Wraps an endpoint handler with method and token checks
+//
+// Parameters:
+//   - method (string) : HTTP method accepted by the endpoint
+//   - handler (func) : Endpoint handler, returns the HTTP status and the response body
+func handle(method string, handler func(r *http.Request) (int, interface{})) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.Settings.Api.Token)) != 1 {
+			write(w, http.StatusUnauthorized, failure("invalid token"))
+			return
+		}
+		if r.Method != method {
+			write(w, http.StatusMethodNotAllowed, failure("method not allowed"))
+			return
+		}
+		code, body := handler(r)
+		write(w, code, body)
+	}
+}
+
+// Returns engine status
+func status(r *http.Request) (int, interface{}) {
+	return http.StatusOK, types.ApiStatus{
+		Engine:   engine.GetData(),
+		Threads:  threads.GetStats(),
+		Paused:   engine.GetPaused(),
+		Draining: engine.IsDraining(),
+		Running:  len(engine.GetRunningJobs()),
+	}
+}
+
+// Returns running jobs
+func jobs(r *http.Request) (int, interface{}) {
+	return http.StatusOK, engine.GetRunningJobs()
+}
+
+// Cancels a running job, path: /jobs/<signature>/cancel, "queue" is only required when the signature runs on several queues
+func cancel(r *http.Request) (int, interface{}) {
+	var path = strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if !strings.HasSuffix(path, "/cancel") {
+		return http.StatusNotFound, failure("not found")
+	}
+	var signature = strings.TrimSuffix(path, "/cancel")
+	if err := engine.Cancel(r.URL.Query().Get("queue"), signature); err != nil {
+		return http.StatusNotFound, failure(err.Error())
+	}
+	return http.StatusAccepted, success("cancelling job #" + signature)
+}
+
+// Pauses a process type, path: /pause/<type>
+func pause(r *http.Request) (int, interface{}) {
+	var processType = processTypeFromPath(r.URL.Path, "/pause/")
+	if err := engine.Pause(processType); err != nil {
+		return http.StatusBadRequest, failure(err.Error())
+	}
+	return http.StatusOK, engine.GetPaused()
+}
+
+// Resumes a process type, path: /resume/<type>
+func resume(r *http.Request) (int, interface{}) {
+	var processType = processTypeFromPath(r.URL.Path, "/resume/")
+	if err := engine.Resume(processType); err != nil {
+		return http.StatusBadRequest, failure(err.Error())
+	}
+	return http.StatusOK, engine.GetPaused()
+}
+
+// Returns quarantined jobs
+func quarantine(r *http.Request) (int, interface{}) {
+	jobs, err := engine.GetQuarantined()
+	if err != nil {
+		return http.StatusInternalServerError, failure(err.Error())
+	}
+	return http.StatusOK, jobs
+}
+
+// Releases a quarantined job, path: /quarantine/<signature>/release
+func release(r *http.Request) (int, interface{}) {
+	var path = strings.TrimPrefix(r.URL.Path, "/quarantine/")
+	if !strings.HasSuffix(path, "/release") {
+		return http.StatusNotFound, failure("not found")
+	}
+	var signature = strings.TrimSuffix(path, "/release")
+	if err := engine.Release(r.URL.Query().Get("queue"), signature); err != nil {
+		return http.StatusNotFound, failure(err.Error())
+	}
+	return http.StatusOK, success("released job #" + signature)
+}
+
+// Triggers an immediate lookup
+func lookup(r *http.Request) (int, interface{}) {
+	engine.Wake()
+	return http.StatusAccepted, success("lookup requested")
+}
+
+// Triggers a maintenance run
+func maintenance(r *http.Request) (int, interface{}) {
+	engine.RequestMaintenance()
+	return http.StatusAccepted, success("maintenance requested")
+}
+
+// Requests a graceful drain followed by a shutdown
+func drain(r *http.Request) (int, interface{}) {
+	engine.Drain()
+	os.Shutdown()
+	return http.StatusAccepted, success("drain requested")
+}
+
+// Maps a path suffix (EG: "pending") to the types.EngineThreadsProcessType value (EG: "Pending")
+func processTypeFromPath(path string, prefix string) string {
+	var name = strings.ToLower(strings.TrimPrefix(path, prefix))
+	for _, processType := range []string{threads.Type.Pending, threads.Type.Update, threads.Type.Maintenance} {
+		if strings.ToLower(processType) == name {
+			return processType
+		}
+	}
+	return name
+}
+
+// Builds a success response body
+func success(message string) map[string]string {
+	return map[string]string{"message": message}
+}
+
+// Builds an error response body
+func failure(message string) map[string]string {
+	return map[string]string{"error": message}
+}
+
+// Writes a JSON response
+func write(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
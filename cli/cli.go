@@ -0,0 +1,494 @@
+// Package cli provides queue management commands, run alongside the worker daemon, so that the queue table can be
+// operated without hand written SQL
+//
+// Queue commands act on the default queue unless "--queue <queue>" names another one of "worker.queues".
+//
+// Available commands:
+//   - enqueue --name <name> --signature <signature> [--repeat <repeat>] [--priority <priority>] [--timeout <seconds>]
+//   - list [--status <status>] [--limit <count>]
+//   - show <signature>
+//   - retry <signature>
+//   - cancel <signature>
+//   - purge --status <status> --older-than <age>
+//   - history <signature> [--since <age>] [--limit <count>]
+//   - quarantine
+//   - release <signature>
+//   - migrate up [--steps <count>] | down [--steps <count>] [--force] | status
+//   - config check
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"os"
+	"query-queue-worker/config"
+	"query-queue-worker/database"
+	"query-queue-worker/engine"
+	"query-queue-worker/engine/schedule"
+	"query-queue-worker/engine/store"
+	"query-queue-worker/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commands handled by this package, the daemon itself is started by the "run" command
+var Commands = map[string]func(args []string){
+	"enqueue":    enqueue,
+	"list":       list,
+	"show":       show,
+	"retry":      retry,
+	"cancel":     cancel,
+	"purge":      purge,
+	"history":    history,
+	"quarantine": quarantine,
+	"release":    release,
+	"migrate":    migrate,
+	"config":     configure,
+}
+
+// Statuses accepted by the "runStatus" column
+var statuses = []string{"pending", "processing", "completed", "failed", "cancelled"}
+
+// Runs a command
+//
+// Parameters:
+//   - command (string) : Name of the command
+//   - args ([]string) : Command arguments
+func Run(command string, args []string) {
+	handler, ok := Commands[command]
+	if !ok {
+		util.Die("Error: unknown command \"%s\"\n", command)
+	}
+	handler(args)
+}
+
+// Prints the usage of every command
+func Usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: query-queue-worker [flags] [command]
+
+Commands:
+  run                                   Start the worker daemon (default)
+  enqueue --name --signature [--repeat] [--priority] [--timeout]
+                                        Add a query to the queue
+  list [--status] [--limit]             List queued queries
+  show <signature>                      Show all the columns of a query
+  retry <signature>                     Move a query back to "pending" and reset its attempts
+  cancel <signature>                    Cancel a query that is not running
+  purge --status --older-than           Delete queries on a status last run before the given age (EG: 30d, 12h)
+  history <signature> [--since] [--limit]
+                                        List past runs of a query with their duration
+  quarantine                            List queries excluded from processing after repeated failures
+  release <signature>                   Release a quarantined query so that it is processed again
+  migrate up|down|status [--steps] [--force]
+                                        Apply, revert or list database schema migrations
+  config check                          Report every problem found on the config file
+
+Queue commands (enqueue to release) accept --queue <queue> to act on a queue other than the default one.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+// Adds a query to the queue
+func enqueue(args []string) {
+	var flags = flag.NewFlagSet("enqueue", flag.ExitOnError)
+	var name = flags.String("name", "", "Query name")
+	var signature = flags.String("signature", "", "Query unique signature")
+	var repeat = flags.String("repeat", "", "Repeat definition (seconds, duration, ISO-8601 duration or cron expression)")
+	var priority = flags.Int("priority", 0, "Query priority, higher values are processed first")
+	var timeout = flags.Int("timeout", 0, "Query timeout in seconds, 0 to use the configured timeout")
+	var queue = queueFlag(flags)
+	flags.Parse(args)
+	var queueTable = tableOf(*queue)
+	if *name == "" || *signature == "" {
+		util.Die("Error: --name and --signature are required\n")
+	}
+	var runRepeat interface{} = nil
+	if *repeat != "" {
+		if err := schedule.Validate(*repeat); err != nil {
+			util.Die("Error: invalid --repeat\n %v\n", err.Error())
+		}
+		runRepeat = *repeat
+	}
+	var runTimeout interface{} = nil
+	if *timeout > 0 {
+		runTimeout = *timeout
+	}
+	var query = `
+		INSERT INTO {table} ({queryName}, {querySignature}, {runRepeat}, {priority}, {runTimeout})
+		VALUES (?, ?, ?, ?, ?)`
+	_, err := database.Exec(queueTable.Expand(query), *name, *signature, runRepeat, *priority, runTimeout)
+	if err != nil {
+		util.Die("Error: cannot enqueue query\n %v\n", err.Error())
+	}
+	fmt.Printf("Enqueued query #%s: %s\n", *signature, *name)
+}
+
+// Lists queued queries
+func list(args []string) {
+	var flags = flag.NewFlagSet("list", flag.ExitOnError)
+	var status = flags.String("status", "", "Only list queries on this status")
+	var limit = flags.Int("limit", 50, "Maximum number of queries to list")
+	var queue = queueFlag(flags)
+	flags.Parse(args)
+	var queueTable = tableOf(*queue)
+	var condition = "1 = 1"
+	var params []interface{}
+	if *status != "" {
+		if err := validateStatus(*status); err != nil {
+			util.Die("Error: %s\n", err.Error())
+		}
+		condition = "{runStatus} = ?"
+		params = append(params, *status)
+	}
+	params = append(params, *limit)
+	var query = `
+		SELECT
+			{querySignature},
+			{queryName},
+			{runStatus},
+			{priority},
+			{attempts},
+			COALESCE({runRepeat}, ''),
+			COALESCE(` + database.Sql.Text("{runLast}") + `, ''),
+			COALESCE(` + database.Sql.Text("{runNext}") + `, '')
+		FROM {table}
+		WHERE ` + condition + `
+		ORDER BY {pkQueryQueueID} DESC
+		LIMIT ?`
+	results, err := database.Query(queueTable.Expand(query), params...)
+	if err != nil {
+		util.Die("Error: cannot list queries\n %v\n", err.Error())
+	}
+	defer results.Close()
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Signature", "Name", "Status", "Priority", "Attempts", "Repeat", "Last Run", "Next Run"})
+	for results.Next() {
+		var row = make([]string, 8)
+		err = results.Scan(&row[0], &row[1], &row[2], &row[3], &row[4], &row[5], &row[6], &row[7])
+		if err != nil {
+			util.Die("Error: cannot scan queries\n %v\n", err.Error())
+		}
+		table.Append(row)
+	}
+	table.Render()
+}
+
+// Shows all the columns of a query
+func show(args []string) {
+	var signature, queueTable = requireSignature("show", args)
+	var columns = []string{
+		"pkQueryQueueID", "querySignature", "queryName", "runStatus", "priority", "runRepeat", "runTimeout", "runTime",
+		"runFirst", "runLast", "runNext", "attempts", "recoveries", "claimedBy", "claimedAt", "leaseExpires", "runError",
+	}
+	var selects = make([]string, len(columns))
+	for i, column := range columns {
+		selects[i] = "COALESCE(" + database.Sql.Text(queueTable.Column(column)) + ", '')"
+	}
+	var query = "SELECT " + strings.Join(selects, ", ") + " FROM " + queueTable.Name + " WHERE " + queueTable.Column("querySignature") + " = ?"
+	var values = make([]string, len(columns))
+	var pointers = make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	err := database.QueryRow(query, signature).Scan(pointers...)
+	if err != nil {
+		util.Die("Error: cannot find query #"+signature+"\n %v\n", err.Error())
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Column", "Value"})
+	table.SetAutoWrapText(false)
+	for i, column := range columns {
+		table.Append([]string{column, values[i]})
+	}
+	table.Render()
+}
+
+// Moves a query back to "pending" and resets its attempts
+func retry(args []string) {
+	var signature, queueTable = requireSignature("retry", args)
+	var query = `
+		UPDATE {table}
+		SET
+			{runStatus} = 'pending',
+			{runError} = NULL,
+			{runNext} = NULL,
+			{attempts} = 0,
+			{recoveries} = 0
+		WHERE
+			{querySignature} = ? AND
+			{runStatus} != 'processing'`
+	updateOne(queueTable.Expand(query), signature, "retry")
+	fmt.Printf("Query #%s moved back to pending\n", signature)
+}
+
+// Cancels a query that is not running, cancelled queries are no longer processed nor retried
+func cancel(args []string) {
+	var signature, queueTable = requireSignature("cancel", args)
+	var query = `
+		UPDATE {table}
+		SET
+			{runStatus} = 'cancelled',
+			{runNext} = NULL
+		WHERE
+			{querySignature} = ? AND
+			{runStatus} != 'processing'`
+	updateOne(queueTable.Expand(query), signature, "cancel")
+	fmt.Printf("Query #%s cancelled\n", signature)
+}
+
+// Deletes queries on a status last run before the given age
+func purge(args []string) {
+	var flags = flag.NewFlagSet("purge", flag.ExitOnError)
+	var status = flags.String("status", "", "Status of the queries to delete")
+	var olderThan = flags.String("older-than", "", "Minimum age since the last run (EG: 30d, 12h)")
+	var queue = queueFlag(flags)
+	flags.Parse(args)
+	var queueTable = tableOf(*queue)
+	if err := validateStatus(*status); err != nil {
+		util.Die("Error: --status: %s\n", err.Error())
+	}
+	if *status == "processing" {
+		util.Die("Error: running queries cannot be purged\n")
+	}
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		util.Die("Error: --older-than: %s\n", err.Error())
+	}
+	var query = `
+		DELETE FROM {table}
+		WHERE
+			{runStatus} = ? AND
+			COALESCE({runLast}, {runFirst}) < ` + database.Sql.AddInterval("CURRENT_TIMESTAMP", "SECOND")
+	result, err := database.Exec(queueTable.Expand(query), *status, -int(age.Seconds()))
+	if err != nil {
+		util.Die("Error: cannot purge queries\n %v\n", err.Error())
+	}
+	count, _ := result.RowsAffected()
+	fmt.Printf("Purged %d %s queries\n", count, *status)
+}
+
+// Lists past runs of a query, most recent first, along with their average duration
+func history(args []string) {
+	var flags = flag.NewFlagSet("history", flag.ExitOnError)
+	var since = flags.String("since", "30d", "Only list runs started within this age (EG: 30d, 12h)")
+	var limit = flags.Int("limit", 50, "Maximum number of runs to list")
+	var queue = queueFlag(flags)
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		util.Die("Error: usage: history <signature> [--since <age>] [--limit <count>] [--queue <queue>]\n")
+	}
+	flags.Parse(args[1:])
+	var signature = args[0]
+	var queueTable = tableOf(*queue)
+	age, err := parseAge(*since)
+	if err != nil {
+		util.Die("Error: --since: %s\n", err.Error())
+	}
+	var query = `
+		SELECT
+			` + database.Sql.Text("startedAt") + `,
+			processType,
+			workerId,
+			runStatus,
+			COALESCE(` + database.Sql.Text("exitCode") + `, ''),
+			durationMs
+		FROM tblCRQueryQueueRun
+		WHERE
+			queueName = ? AND
+			querySignature = ? AND
+			startedAt >= ` + database.Sql.AddInterval("CURRENT_TIMESTAMP", "SECOND") + `
+		ORDER BY startedAt DESC
+		LIMIT ?`
+	results, err := database.Query(query, queueTable.Queue, signature, -int(age.Seconds()), *limit)
+	if err != nil {
+		util.Die("Error: cannot list run history\n %v\n", err.Error())
+	}
+	defer results.Close()
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Started At", "Type", "Worker", "Status", "Exit Code", "Duration"})
+	var count, total int
+	for results.Next() {
+		var row = make([]string, 5)
+		var durationMs int
+		err = results.Scan(&row[0], &row[1], &row[2], &row[3], &row[4], &durationMs)
+		if err != nil {
+			util.Die("Error: cannot scan run history\n %v\n", err.Error())
+		}
+		table.Append(append(row, (time.Duration(durationMs) * time.Millisecond).String()))
+		count++
+		total += durationMs
+	}
+	if count > 0 {
+		table.SetFooter([]string{"", "", "", "", "Average", (time.Duration(total/count) * time.Millisecond).String()})
+	}
+	table.Render()
+}
+
+// Lists quarantined queries, most recent first
+func quarantine(args []string) {
+	jobs, err := engine.GetQuarantined()
+	if err != nil {
+		util.Die("Error: cannot list quarantined queries\n %v\n", err.Error())
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Queue", "Signature", "Name", "Type", "Failures", "Quarantined At", "Release At", "Last Error"})
+	for _, job := range jobs {
+		var releaseAt = job.ReleaseAt
+		if releaseAt == "" {
+			releaseAt = "manual"
+		}
+		table.Append([]string{
+			job.Queue,
+			job.Signature,
+			job.Name,
+			job.Type,
+			strconv.Itoa(job.Failures),
+			job.QuarantinedAt,
+			releaseAt,
+			util.Tail(strings.TrimSpace(job.LastError), 80),
+		})
+	}
+	table.Render()
+}
+
+// Releases a quarantined query so that it is processed again
+func release(args []string) {
+	var signature, queueTable = requireSignature("release", args)
+	if err := engine.Release(queueTable.Queue, signature); err != nil {
+		util.Die("Error: cannot release query #"+signature+"\n %v\n", err.Error())
+	}
+	fmt.Printf("Query #%s released from quarantine\n", signature)
+}
+
+// Applies, reverts or lists database schema migrations
+func migrate(args []string) {
+	if len(args) < 1 {
+		util.Die("Error: usage: migrate up|down|status [--steps <count>] [--force]\n")
+	}
+	var flags = flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	var steps = flags.Int("steps", 0, "Number of migrations to apply or revert (up: 0 applies all, down: defaults to 1)")
+	var force = flags.Bool("force", false, "Revert migrations even when they delete rows (down only)")
+	flags.Parse(args[1:])
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(*steps)
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			util.Die("Error: %v\n", err.Error())
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		break
+	case "down":
+		if *steps <= 0 {
+			*steps = 1
+		}
+		reverted, err := database.MigrateDown(*steps, *force)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			util.Die("Error: %v\n", err.Error())
+		}
+		break
+	case "status":
+		migrations, err := database.MigrationStatus()
+		if err != nil {
+			util.Die("Error: %v\n", err.Error())
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Version", "Name", "Applied At"})
+		for _, migration := range migrations {
+			var appliedAt = migration.AppliedAt
+			if appliedAt == "" {
+				appliedAt = "pending"
+			}
+			table.Append([]string{fmt.Sprintf("%04d", migration.Version), migration.Name, appliedAt})
+		}
+		table.Render()
+		break
+	default:
+		util.Die("Error: unknown migrate action \"%s\"\n", args[0])
+	}
+}
+
+// Checks the config file, reporting every problem found on it at once
+func configure(args []string) {
+	if len(args) != 1 || args[0] != "check" {
+		util.Die("Error: usage: config check\n")
+	}
+	var problems = config.Check()
+	if len(problems) > 0 {
+		util.Die("Error: invalid config\n - %s\n", strings.Join(problems, "\n - "))
+	}
+	fmt.Println("Config is valid")
+}
+
+// Returns the signature argument of a command along with the table of its "--queue" flag, exiting when it is missing
+func requireSignature(command string, args []string) (string, store.Table) {
+	var flags = flag.NewFlagSet(command, flag.ExitOnError)
+	var queue = queueFlag(flags)
+	if len(args) < 1 || args[0] == "" || strings.HasPrefix(args[0], "-") {
+		util.Die("Error: usage: %s <signature> [--queue <queue>]\n", command)
+	}
+	flags.Parse(args[1:])
+	if flags.NArg() > 0 {
+		util.Die("Error: usage: %s <signature> [--queue <queue>]\n", command)
+	}
+	return args[0], tableOf(*queue)
+}
+
+// Registers the "--queue" flag of a queue command
+func queueFlag(flags *flag.FlagSet) *string {
+	return flags.String("queue", "", "Queue name (\"worker.queues\"), the default queue when empty")
+}
+
+// Returns the table of a queue, exiting when the queue is unknown
+func tableOf(queue string) store.Table {
+	table, err := store.TableOf(queue)
+	if err != nil {
+		util.Die("Error: --queue: %s\n", err.Error())
+	}
+	return table
+}
+
+// Runs an update expected to change exactly one query, exiting when the query is missing or running
+func updateOne(query string, signature string, action string) {
+	result, err := database.Exec(query, signature)
+	if err != nil {
+		util.Die("Error: cannot "+action+" query\n %v\n", err.Error())
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		util.Die("Error: query #%s not found or currently running\n", signature)
+	}
+}
+
+// Checks that a status is accepted by the "runStatus" column
+func validateStatus(status string) error {
+	for _, valid := range statuses {
+		if status == valid {
+			return nil
+		}
+	}
+	return errors.New("status must be one of " + strings.Join(statuses, ", "))
+}
+
+// Parses an age, either as a GO duration (EG: "12h") or as a number of days (EG: "30d")
+func parseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err == nil && days > 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	} else if duration, err := time.ParseDuration(age); err == nil && duration > 0 {
+		return duration, nil
+	}
+	return 0, errors.New("invalid age \"" + age + "\", use EG: 30d or 12h")
+}
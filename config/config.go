@@ -1,19 +1,205 @@
 // Package config loads configuration file "query-queue-config.json" into a public Settings variable to be accessed publicly
 //
-// It relies on types.go package to parse JSON structure
+// Settings are layered: default values, then the JSON config file, then QQW_* environment variables, then command line
+// flags. It relies on types.go package to parse JSON structure
 package config
 
 import (
+	"errors"
+	"fmt"
+	"github.com/creasty/defaults"
+	"os"
 	"query-queue-worker/types"
 	"query-queue-worker/util"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
-var Settings = types.AppConfig{} // Holds configuration from the JSON config file
+var Settings = types.AppConfig{} // Holds configuration from the JSON config file, environment variables and flags
+var liveMu = sync.RWMutex{}      // Guards the settings applied live by Reload, these are read through Current()
 
-// Loads config from JSON config file
+const DefaultQueue = "default"         // Name of the queue processed when "worker.queues" is not set
+const DefaultTable = "tblCRQueryQueue" // Queue table of the queue processed when "worker.queues" is not set
+
+var path = "query-queue-config.json" // Location of the JSON config file
+var required = false                 // Set when the location of the config file was given, it must then exist
+var changed = make(chan bool, 1)     // Receives a notification when the watched config file is modified
+
+// Sets the location of the JSON config file, before the config is loaded
+//
+// Parameters:
+//   - fileName (string) : Location of the JSON config file
+//   - given (bool) : Weather the location was given (EG: "--config" flag) rather than the default one, a missing file is
+//     only accepted on the default location
+func SetPath(fileName string, given bool) {
+	path = fileName
+	required = given
+}
+
+// Loads config from JSON config file, environment variables and command line flags
+//
+// Every problem found on the config file (unknown keys, missing or invalid values) is reported at once before exiting
 func Init() {
-	err := util.ReadJson("query-queue-config.json", &Settings)
-	if err != nil {
-		util.Die("Error: cannot load config\n %v\n", err.Error())
+	settings, problems := loadChecked()
+	if len(problems) > 0 {
+		util.Die("Error: invalid config "+path+"\n - %s\n", strings.Join(problems, "\n - "))
+	}
+	Settings = settings
+}
+
+// Reads the JSON config file, applying default values for keys missing from it
+//
+// A missing config file is accepted on the default location, so that settings can be given only through environment
+// variables and flags
+//
+// Returns:
+//   - types.AppConfig : Loaded configuration
+//   - error : Set when the file cannot be read or decoded
+func load() (types.AppConfig, error) {
+	var settings = types.AppConfig{}
+	defaults.Set(&settings)
+	err := util.ReadJson(path, &settings)
+	if os.IsNotExist(err) && !required {
+		err = nil
+	}
+	return settings, err
+}
+
+// Re-reads the JSON config file and applies the settings that can change while the worker is running
+//
+// Settings applied live: "threads.max", "worker.idle", "worker.commands", "worker.processes.maintenance.idle" and
+// "logs.level". Other changes are reported and only applied on restart. When the file cannot be loaded or is invalid the
+// current settings are kept.
+//
+// Returns:
+//   - []string : Description of every applied change (EG: "threads.max: 5 -> 8")
+//   - bool : Weather the file holds changes that require a restart
+//   - error : Set when the file cannot be loaded or is invalid
+func Reload() ([]string, bool, error) {
+	settings, problems := loadChecked()
+	if len(problems) > 0 {
+		return nil, false, errors.New(strings.Join(problems, "; "))
+	}
+	var changes []string
+	changes = diff(changes, "threads.max", Settings.Threads.Max, settings.Threads.Max)
+	changes = diff(changes, "worker.idle", Settings.Worker.Idle, settings.Worker.Idle)
+	changes = diff(changes, "worker.commands.single", Settings.Worker.Commands.Single, settings.Worker.Commands.Single)
+	changes = diff(changes, "worker.commands.update", Settings.Worker.Commands.Update, settings.Worker.Commands.Update)
+	changes = diff(changes, "worker.commands.maintenance", Settings.Worker.Commands.Maintenance, settings.Worker.Commands.Maintenance)
+	changes = diff(changes, "worker.processes.maintenance.idle", Settings.Worker.Processes.Maintenance.Idle, settings.Worker.Processes.Maintenance.Idle)
+	changes = diff(changes, "logs.level", Settings.Logs.Level, settings.Logs.Level)
+	// Apply live settings, anything else left different requires a restart
+	var applied = Settings
+	applied.Threads.Max = settings.Threads.Max
+	applied.Worker.Idle = settings.Worker.Idle
+	applied.Worker.Commands = settings.Worker.Commands
+	applied.Worker.Processes.Maintenance.Idle = settings.Worker.Processes.Maintenance.Idle
+	applied.Logs.Level = settings.Logs.Level
+	var restart = !reflect.DeepEqual(applied, settings)
+	// Only the live settings are written, the others are read without locking
+	liveMu.Lock()
+	Settings.Threads.Max = applied.Threads.Max
+	Settings.Worker.Idle = applied.Worker.Idle
+	Settings.Worker.Commands = applied.Worker.Commands
+	Settings.Worker.Processes.Maintenance.Idle = applied.Worker.Processes.Maintenance.Idle
+	Settings.Logs.Level = applied.Logs.Level
+	liveMu.Unlock()
+	return changes, restart, nil
+}
+
+// Returns a copy of the settings, the settings applied live by Reload must be read through it while the worker is
+// running as they may be changed by another go routine
+func Current() types.AppConfig {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return Settings
+}
+
+// Appends the description of a changed setting
+//
+// Parameters:
+//   - changes ([]string) : Changes found so far
+//   - key (string) : Setting key
+//   - current (interface{}) : Current value
+//   - loaded (interface{}) : Value read from the config file
+//
+// Returns:
+//   - []string : Changes including the setting when its value changed
+func diff(changes []string, key string, current interface{}, loaded interface{}) []string {
+	if current == loaded {
+		return changes
+	}
+	return append(changes, fmt.Sprintf("%s: %v -> %v", key, current, loaded))
+}
+
+// Watches the config file for modifications when "reload.watch" is enabled, notifying them on Changed()
+func Watch() {
+	if !Settings.Reload.Watch || Settings.Reload.Interval <= 0 {
+		return
+	}
+	go func() {
+		var modified time.Time
+		if info, err := os.Stat(path); err == nil {
+			modified = info.ModTime()
+		}
+		var ticker = time.NewTicker(time.Second * time.Duration(Settings.Reload.Interval))
+		defer ticker.Stop()
+		for range ticker.C {
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modified) {
+				continue
+			}
+			modified = info.ModTime()
+			select {
+			case changed <- true:
+			default:
+			}
+		}
+	}()
+}
+
+// Returns a channel notified when the watched config file is modified
+func Changed() <-chan bool {
+	return changed
+}
+
+// Returns the queues processed by the worker, by name
+//
+// When "worker.queues" is not set, a single "default" queue on the "tblCRQueryQueue" table is processed
+func Queues() map[string]types.AppConfigWorkerQueue {
+	if len(Settings.Worker.Queues) > 0 {
+		return Settings.Worker.Queues
+	}
+	return map[string]types.AppConfigWorkerQueue{DefaultQueue: {Table: DefaultTable}}
+}
+
+// Returns the names of the queues processed by the worker, the default queue first and the others sorted by name
+//
+// The default queue is the one named "default" or, when there is none, the first queue by name. Commands and API
+// endpoints given no queue act on it, and it holds the maintenance job history.
+func QueueNames() []string {
+	var names []string
+	for name := range Queues() {
+		if name != DefaultQueue {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := Queues()[DefaultQueue]; ok {
+		names = append([]string{DefaultQueue}, names...)
+	}
+	return names
+}
+
+// Returns the columns of the queue table that can be remapped per queue, as named by types.TblCRQueryQueue "TbField" tags
+func QueueColumns() []string {
+	var t = reflect.TypeOf(types.TblCRQueryQueue{})
+	var columns = make([]string, t.NumField())
+	for i := range columns {
+		columns[i] = t.Field(i).Tag.Get("TbField")
 	}
+	return columns
 }
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"query-queue-worker/types"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const envPrefix = "QQW_" // Prefix of the environment variables overriding settings
+
+var flagValues = map[string]string{} // Values of the settings given as command line flags, by key
+
+var credentialParam = regexp.MustCompile(`(?i)pass|pwd|secret|token|auth|key`)                   // Connection parameters holding credentials
+var urlCredentials = regexp.MustCompile(`([^\s:/@]+):[^\s@]*@`)                                  // Credentials of URLs and DSNs (EG: "user:password@")
+var pairCredentials = regexp.MustCompile(`(?i)([\w.]*(?:pass|pwd|secret|token)[\w.]*=)[^\s&;]*`) // Credentials of key=value connection strings
+
+// Registers one command line flag per setting (EG: --worker.lease.timeout), overriding the config file and the
+// environment variables
+//
+// Parameters:
+//   - flags (*flag.FlagSet) : Flag set on which the flags are registered, before it is parsed
+func RegisterFlags(flags *flag.FlagSet) {
+	var settings = types.AppConfig{}
+	walk(reflect.ValueOf(&settings).Elem(), "", func(key string, value reflect.Value, field reflect.StructField) {
+		flags.Func(key, "Overrides \""+key+"\" (env "+envName(key)+")", func(raw string) error {
+			flagValues[key] = raw
+			return nil
+		})
+	})
+}
+
+// Applies the environment variables and command line flags over settings loaded from the config file
+//
+// Each setting can be given as QQW_<KEY> (EG: QQW_WORKER_LEASE_TIMEOUT for "worker.lease.timeout") or, for secrets, as
+// QQW_<KEY>_FILE holding the location of a file with the value. Command line flags take precedence over environment
+// variables. Lists and maps are given as JSON.
+//
+// Parameters:
+//   - settings (*types.AppConfig) : Settings loaded from the config file
+//
+// Returns:
+//   - []string : Every value that cannot be applied
+func applyOverrides(settings *types.AppConfig) []string {
+	var problems []string
+	walk(reflect.ValueOf(settings).Elem(), "", func(key string, value reflect.Value, field reflect.StructField) {
+		var name = envName(key)
+		raw, fromEnv := os.LookupEnv(name)
+		if file, ok := os.LookupEnv(name + "_FILE"); ok {
+			if fromEnv {
+				problems = append(problems, name+" and "+name+"_FILE cannot be both set")
+				return
+			}
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				problems = append(problems, name+"_FILE: "+err.Error())
+				return
+			}
+			raw, fromEnv = strings.TrimRight(string(content), "\r\n"), true
+		}
+		if fromEnv {
+			if err := setValue(value, raw); err != nil {
+				problems = append(problems, name+": "+err.Error())
+			}
+		}
+		if raw, ok := flagValues[key]; ok {
+			if err := setValue(value, raw); err != nil {
+				problems = append(problems, "flag --"+key+": "+err.Error())
+			}
+		}
+	})
+	return problems
+}
+
+// Returns the current settings as JSON, with secrets (EG: "mysql.password") masked so that they can be logged
+//
+// Connection parameters named after credentials (EG: "mysql.params.password") and credentials written in DSNs or URLs on
+// any setting (EG: "user:password@host", "password=secret") are masked as well
+func Redacted() string {
+	var settings = Current()
+	walk(reflect.ValueOf(&settings).Elem(), "", func(key string, value reflect.Value, field reflect.StructField) {
+		if field.Tag.Get("secret") == "true" && value.String() != "" {
+			value.SetString("******")
+			return
+		}
+		switch value.Kind() {
+		case reflect.String:
+			value.SetString(redactDsn(value.String()))
+		case reflect.Map:
+			// Maps are shared with the current settings, a masked copy is set instead
+			if params, ok := value.Interface().(map[string]string); ok && params != nil {
+				var masked = make(map[string]string, len(params))
+				for name, param := range params {
+					masked[name] = redactDsn(param)
+					if credentialParam.MatchString(name) && param != "" {
+						masked[name] = "******"
+					}
+				}
+				value.Set(reflect.ValueOf(masked))
+			}
+		}
+	})
+	var content = strings.Builder{}
+	var encoder = json.NewEncoder(&content)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(settings)
+	return strings.TrimSpace(content.String())
+}
+
+// Masks the credentials written in a DSN or URL
+//
+// Parameters:
+//   - value (string) : Setting value
+//
+// Returns:
+//   - string : Value with its credentials masked (EG: "user:******@host")
+func redactDsn(value string) string {
+	value = urlCredentials.ReplaceAllString(value, "$1:******@")
+	return pairCredentials.ReplaceAllString(value, "${1}******")
+}
+
+// Calls a function for every setting holding a value (not a group of settings)
+//
+// Parameters:
+//   - v (reflect.Value) : Addressable struct holding the settings
+//   - prefix (string) : Key of the struct, empty for the root
+//   - fn (func) : Called with the setting key (EG: "worker.lease.timeout"), its value and its struct field
+func walk(v reflect.Value, prefix string, fn func(key string, value reflect.Value, field reflect.StructField)) {
+	var t = v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		var field = t.Field(i)
+		var key = prefix + strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), key+".", fn)
+			continue
+		}
+		fn(key, v.Field(i), field)
+	}
+}
+
+// Builds the environment variable name of a setting
+//
+// Parameters:
+//   - key (string) : Setting key (EG: "worker.lease.maxRecoveries")
+//
+// Returns:
+//   - string : Environment variable name (EG: "QQW_WORKER_LEASE_MAX_RECOVERIES")
+func envName(key string) string {
+	var name = strings.Builder{}
+	name.WriteString(envPrefix)
+	for i, char := range key {
+		if char == '.' {
+			name.WriteRune('_')
+			continue
+		}
+		if unicode.IsUpper(char) && i > 0 && key[i-1] != '.' {
+			name.WriteRune('_')
+		}
+		name.WriteRune(unicode.ToUpper(char))
+	}
+	return name.String()
+}
+
+// Parses a raw value into a setting
+//
+// Parameters:
+//   - value (reflect.Value) : Addressable setting value
+//   - raw (string) : Value to parse, lists and maps are given as JSON
+//
+// Returns:
+//   - error : Set when the value cannot be parsed into the setting type
+func setValue(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("expected true or false, got \"" + raw + "\"")
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return errors.New("expected an integer, got \"" + raw + "\"")
+		}
+		value.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return errors.New("expected a positive integer, got \"" + raw + "\"")
+		}
+		value.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return errors.New("expected a number, got \"" + raw + "\"")
+		}
+		value.SetFloat(parsed)
+	default:
+		var parsed = reflect.New(value.Type())
+		if err := json.Unmarshal([]byte(raw), parsed.Interface()); err != nil {
+			return errors.New("expected JSON: " + err.Error())
+		}
+		value.Set(parsed.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"github.com/creasty/defaults"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"query-queue-worker/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	var tests = []struct {
+		key  string
+		name string
+	}{
+		{"driver", "QQW_DRIVER"},
+		{"mysql.password", "QQW_MYSQL_PASSWORD"},
+		{"worker.lease.maxRecoveries", "QQW_WORKER_LEASE_MAX_RECOVERIES"},
+		{"threads.waitToFinish", "QQW_THREADS_WAIT_TO_FINISH"},
+		{"postgres.sslRootCert", "QQW_POSTGRES_SSL_ROOT_CERT"},
+	}
+	for _, test := range tests {
+		if name := envName(test.key); name != test.name {
+			t.Errorf("envName(%q) = %q, want %q", test.key, name, test.name)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	var settings = struct {
+		Text    string
+		Flag    bool
+		Count   int
+		Size    uint
+		Ratio   float64
+		Names   []string
+		Options map[string]string
+	}{}
+	var value = reflect.ValueOf(&settings).Elem()
+	var tests = []struct {
+		field string
+		raw   string
+		want  interface{}
+		valid bool
+	}{
+		{"Text", "php run.php %s", "php run.php %s", true},
+		{"Flag", "true", true, true},
+		{"Flag", "yes", nil, false},
+		{"Count", "-3", -3, true},
+		{"Count", "3.5", nil, false},
+		{"Size", "10", uint(10), true},
+		{"Size", "-1", nil, false},
+		{"Ratio", "0.25", 0.25, true},
+		{"Ratio", "quarter", nil, false},
+		{"Names", `["a", "b"]`, []string{"a", "b"}, true},
+		{"Names", "a,b", nil, false},
+		{"Options", `{"tls": "true"}`, map[string]string{"tls": "true"}, true},
+	}
+	for _, test := range tests {
+		var field = value.FieldByName(test.field)
+		var err = setValue(field, test.raw)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("setValue(%s, %q) returned no error", test.field, test.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("setValue(%s, %q) returned error: %v", test.field, test.raw, err)
+		} else if !reflect.DeepEqual(field.Interface(), test.want) {
+			t.Errorf("setValue(%s, %q) set %v, want %v", test.field, test.raw, field.Interface(), test.want)
+		}
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	var secret = filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(secret, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("cannot write secret file: %v", err)
+	}
+	var env = map[string]string{
+		"QQW_WORKER_IDLE":         "7",
+		"QQW_THREADS_MAX":         "8",
+		"QQW_MYSQL_PASSWORD_FILE": secret,
+		"QQW_MYSQL_PARAMS":        `{"tls": "true"}`,
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	flagValues = map[string]string{"threads.max": "9"}
+	defer func() {
+		flagValues = map[string]string{}
+	}()
+	var settings = types.AppConfig{}
+	defaults.Set(&settings)
+	settings.Worker.Idle = 1
+	settings.Mysql.Password = "from-config"
+	if problems := applyOverrides(&settings); len(problems) > 0 {
+		t.Fatalf("applyOverrides returned problems: %v", problems)
+	}
+	if settings.Worker.Idle != 7 {
+		t.Errorf("worker.idle = %d, want 7 from the environment", settings.Worker.Idle)
+	}
+	if settings.Threads.Max != 9 {
+		t.Errorf("threads.max = %d, want 9 from the flag over the environment", settings.Threads.Max)
+	}
+	if settings.Mysql.Password != "from-file" {
+		t.Errorf("mysql.password = %q, want \"from-file\" from the _FILE variable", settings.Mysql.Password)
+	}
+	if !reflect.DeepEqual(settings.Mysql.Params, map[string]string{"tls": "true"}) {
+		t.Errorf("mysql.params = %v, want the JSON map from the environment", settings.Mysql.Params)
+	}
+	// A value and its _FILE variant cannot be both set, invalid values are reported
+	os.Setenv("QQW_MYSQL_PASSWORD", "from-env")
+	defer os.Unsetenv("QQW_MYSQL_PASSWORD")
+	os.Setenv("QQW_WORKER_IDLE", "soon")
+	var problems = applyOverrides(&settings)
+	var want = []string{
+		"QQW_MYSQL_PASSWORD and QQW_MYSQL_PASSWORD_FILE cannot be both set",
+		`QQW_WORKER_IDLE: expected an integer, got "soon"`,
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("applyOverrides problems = %q, want %q", problems, want)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	Settings = types.AppConfig{}
+	defaults.Set(&Settings)
+	Settings.Mysql.Password = "secret-password"
+	Settings.Mysql.Params = map[string]string{"password": "secret-param", "authToken": "secret-token", "tls": "preferred"}
+	Settings.Postgres.Params = map[string]string{"options": "host=db password=secret-pair sslmode=disable"}
+	Settings.Postgres.Hostname = "user:secret-url@db.local"
+	Settings.Api.Token = "secret-api"
+	var redacted = Redacted()
+	for _, secret := range []string{"secret-password", "secret-param", "secret-token", "secret-pair", "secret-url", "secret-api"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("Redacted() holds %q: %s", secret, redacted)
+		}
+	}
+	for _, kept := range []string{`"tls":"preferred"`, `host=db password=****** sslmode=disable`, `user:******@db.local`} {
+		if !strings.Contains(redacted, kept) {
+			t.Errorf("Redacted() is missing %q: %s", kept, redacted)
+		}
+	}
+	// The current settings are left untouched
+	if Settings.Mysql.Params["password"] != "secret-param" || Settings.Postgres.Hostname != "user:secret-url@db.local" {
+		t.Errorf("Redacted() changed the current settings")
+	}
+}
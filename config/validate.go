@@ -0,0 +1,571 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"query-queue-worker/log"
+	"query-queue-worker/types"
+	"query-queue-worker/util"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var queueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)                           // Queue names, also stored on the quarantine and run history tables
+var tablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`) // Table names, optionally schema qualified
+var columnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)                           // Column names
+
+// Loads the JSON config file and reports every problem found on it, without changing the current settings
+//
+// Returns:
+//   - []string : Problems found, empty when the config file is valid
+func Check() []string {
+	_, problems := loadChecked()
+	return problems
+}
+
+// Loads the JSON config file along with the environment variables and flags, rejecting unknown keys and invalid values
+//
+// Returns:
+//   - types.AppConfig : Loaded configuration
+//   - []string : Every problem found, empty when the config file is valid
+func loadChecked() (types.AppConfig, []string) {
+	settings, err := load()
+	if err != nil {
+		return settings, []string{err.Error()}
+	}
+	problems, err := unknownKeysOf(path)
+	if err != nil {
+		return settings, []string{err.Error()}
+	}
+	problems = append(problems, applyOverrides(&settings)...)
+	return settings, append(problems, Validate(&settings)...)
+}
+
+// Reports keys of a JSON config file that do not match any setting, these would otherwise be silently ignored
+//
+// Parameters:
+//   - fileName (string) : Location of the JSON config file
+//
+// Returns:
+//   - []string : One problem per unknown key
+//   - error : Set when the file cannot be read or decoded
+func unknownKeysOf(fileName string) ([]string, error) {
+	var raw interface{}
+	if err := util.ReadJson(fileName, &raw); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return unknownKeys(raw, reflect.TypeOf(types.AppConfig{}), ""), nil
+}
+
+// Walks a decoded JSON value along with the type it is decoded into, reporting keys that have no matching field
+//
+// Parameters:
+//   - value (interface{}) : Decoded JSON value
+//   - t (reflect.Type) : Type the value is decoded into
+//   - prefix (string) : Key of the value, used on the reported problems
+//
+// Returns:
+//   - []string : One problem per unknown key
+func unknownKeys(value interface{}, t reflect.Type, prefix string) []string {
+	var problems []string
+	var object, ok = value.(map[string]interface{})
+	// Type mismatches are reported by the JSON decoder
+	if !ok {
+		return problems
+	}
+	var keys = make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	switch t.Kind() {
+	case reflect.Struct:
+		// Map JSON names to fields, matching is case insensitive as on the JSON decoder
+		var fields = map[string]reflect.Type{}
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			var name = strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			fields[strings.ToLower(name)] = t.Field(i).Type
+			names = append(names, name)
+		}
+		for _, key := range keys {
+			fieldType, ok := fields[strings.ToLower(key)]
+			if !ok {
+				problems = append(problems, "unknown key "+prefix+key+" (valid keys: "+strings.Join(names, ", ")+")")
+				continue
+			}
+			problems = append(problems, unknownKeys(object[key], fieldType, prefix+key+".")...)
+		}
+		break
+	case reflect.Map:
+		for _, key := range keys {
+			problems = append(problems, unknownKeys(object[key], t.Elem(), prefix+key+".")...)
+		}
+		break
+	}
+	return problems
+}
+
+// Validates settings values
+//
+// Parameters:
+//   - settings (*types.AppConfig) : Settings to validate
+//
+// Returns:
+//   - []string : Every problem found, empty when the settings are valid
+func Validate(settings *types.AppConfig) []string {
+	var problems []string
+	var check = func(valid bool, problem string) {
+		if !valid {
+			problems = append(problems, problem)
+		}
+	}
+	// Logs
+	if settings.Logs.Enabled {
+		check(settings.Logs.Path != "", "logs.path is required when logs are enabled")
+		check(settings.Logs.MaxSize > 0, "logs.maxSize must be greater than 0")
+		check(settings.Logs.MaxCount > 0, "logs.maxCount must be greater than 0")
+	}
+	if _, err := log.ParseLevel(settings.Logs.Level); err != nil {
+		problems = append(problems, "logs.level "+err.Error())
+	}
+	// Threads
+	check(settings.Threads.Max >= 3, "threads.max must be at least 3, one thread per process type is required")
+	// Database
+	switch settings.Driver {
+	case "mysql":
+		problems = append(problems, validateMysql(settings.Mysql)...)
+	case "postgres":
+		problems = append(problems, validatePostgres(settings.Postgres)...)
+	case "sqlite":
+		problems = append(problems, validateSqlite(settings.Sqlite)...)
+	default:
+		problems = append(problems, "driver must be \"mysql\", \"postgres\" or \"sqlite\", got \""+settings.Driver+"\"")
+	}
+	// Worker
+	var worker = settings.Worker
+	check(worker.Idle > 0, "worker.idle must be greater than 0")
+	check(worker.Timeout >= 0, "worker.timeout cannot be negative")
+	if worker.Timezone != "" {
+		if _, err := time.LoadLocation(worker.Timezone); err != nil {
+			problems = append(problems, "worker.timezone is not a known timezone: "+err.Error())
+		}
+	}
+	if problem := checkExecutable(worker.Executable); problem != "" {
+		problems = append(problems, "worker.executable "+problem)
+	}
+	check(worker.Lease.Timeout > 0, "worker.lease.timeout must be greater than 0")
+	check(worker.Lease.Heartbeat > 0 && worker.Lease.Heartbeat < worker.Lease.Timeout, "worker.lease.heartbeat must be greater than 0 and lower than worker.lease.timeout")
+	check(worker.Lease.MaxRecoveries >= 0, "worker.lease.maxRecoveries cannot be negative")
+	problems = append(problems, validateRetryPolicy("worker.retry.default", worker.Retry.Default)...)
+	for name, policy := range worker.Retry.Queries {
+		problems = append(problems, validateRetryPolicy("worker.retry.queries."+name, MergeRetryPolicy(worker.Retry.Default, policy))...)
+	}
+	check(worker.Priority.Aging >= 0, "worker.priority.aging cannot be negative")
+	for name, group := range worker.Concurrency.Groups {
+		check(len(name) <= 64, "worker.concurrency.groups."+name+" name cannot be longer than 64 characters")
+		check(group.Limit > 0, "worker.concurrency.groups."+name+".limit must be greater than 0")
+		check(len(group.Queries) > 0, "worker.concurrency.groups."+name+".queries requires at least one query name")
+	}
+	check(worker.History.Retention >= 0, "worker.history.retention cannot be negative")
+	check(worker.History.OutputLength > 0, "worker.history.outputLength must be greater than 0")
+	check(worker.Stats.Flush > 0, "worker.stats.flush must be greater than 0")
+	check(worker.Quarantine.Failures >= 0, "worker.quarantine.failures cannot be negative")
+	check(worker.Quarantine.Cooldown >= 0, "worker.quarantine.cooldown cannot be negative")
+	// Commands receive the query signature, apart from the maintenance command
+	problems = append(problems, validateCommand("worker.commands.single", worker.Commands.Single, 1)...)
+	problems = append(problems, validateCommand("worker.commands.update", worker.Commands.Update, 1)...)
+	problems = append(problems, validateCommand("worker.commands.maintenance", worker.Commands.Maintenance, 0)...)
+	check(worker.Processes.Pending.Timeout >= 0, "worker.processes.pending.timeout cannot be negative")
+	check(worker.Processes.Update.Timeout >= 0, "worker.processes.update.timeout cannot be negative")
+	check(worker.Processes.Maintenance.Timeout >= 0, "worker.processes.maintenance.timeout cannot be negative")
+	check(worker.Processes.Maintenance.Idle > 0, "worker.processes.maintenance.idle must be greater than 0")
+	problems = append(problems, validateQueues(worker.Queues)...)
+	// Metrics
+	if settings.Metrics.Enabled {
+		check(settings.Metrics.Address != "", "metrics.address is required when metrics are enabled")
+		check(strings.HasPrefix(settings.Metrics.Path, "/"), "metrics.path must start with \"/\"")
+	}
+	// Admin API
+	if settings.Api.Enabled {
+		check(settings.Api.Address != "", "api.address is required when the API is enabled")
+		check(settings.Api.Token != "", "api.token is required when the API is enabled")
+	}
+	// Reload
+	if settings.Reload.Watch {
+		check(settings.Reload.Interval > 0, "reload.interval must be greater than 0 when reload.watch is enabled")
+	}
+	return problems
+}
+
+// Validates the "mysql" settings, used when "driver" is "mysql"
+//
+// Parameters:
+//   - mysql (types.AppConfigMysql) : Settings to validate
+//
+// Returns:
+//   - []string : Every problem found
+func validateMysql(mysql types.AppConfigMysql) []string {
+	var problems []string
+	var check = func(valid bool, problem string) {
+		if !valid {
+			problems = append(problems, problem)
+		}
+	}
+	if mysql.Socket == "" {
+		check(mysql.Hostname != "", "mysql.hostname is required, unless mysql.socket is set")
+		if _, err := strconv.Atoi(mysql.Port); err != nil {
+			problems = append(problems, "mysql.port must be a number, got \""+mysql.Port+"\"")
+		}
+	} else if _, err := os.Stat(mysql.Socket); err != nil {
+		problems = append(problems, "mysql.socket \""+mysql.Socket+"\" does not exist")
+	}
+	check(mysql.Database != "", "mysql.database is required")
+	check(mysql.Username != "", "mysql.username is required")
+	if mysql.Tls.Enabled {
+		check((mysql.Tls.Cert == "") == (mysql.Tls.Key == ""), "mysql.tls.cert and mysql.tls.key must be set together")
+		problems = append(problems, checkFiles("mysql.tls.", map[string]string{"ca": mysql.Tls.Ca, "cert": mysql.Tls.Cert, "key": mysql.Tls.Key})...)
+	}
+	check(mysql.Timeout >= 0, "mysql.timeout cannot be negative")
+	check(mysql.ReadTimeout >= 0, "mysql.readTimeout cannot be negative")
+	check(mysql.WriteTimeout >= 0, "mysql.writeTimeout cannot be negative")
+	if _, err := time.LoadLocation(mysql.Loc); err != nil {
+		problems = append(problems, "mysql.loc is not a known timezone: "+err.Error())
+	}
+	problems = append(problems, validatePool("mysql.pool", mysql.Pool)...)
+	problems = append(problems, validateConnectRetry("mysql.retry", mysql.Retry)...)
+	return problems
+}
+
+// Validates the "postgres" settings, used when "driver" is "postgres"
+//
+// Parameters:
+//   - postgres (types.AppConfigPostgres) : Settings to validate
+//
+// Returns:
+//   - []string : Every problem found
+func validatePostgres(postgres types.AppConfigPostgres) []string {
+	var problems []string
+	var check = func(valid bool, problem string) {
+		if !valid {
+			problems = append(problems, problem)
+		}
+	}
+	if postgres.Socket == "" {
+		check(postgres.Hostname != "", "postgres.hostname is required, unless postgres.socket is set")
+		if _, err := strconv.Atoi(postgres.Port); err != nil {
+			problems = append(problems, "postgres.port must be a number, got \""+postgres.Port+"\"")
+		}
+	} else if _, err := os.Stat(postgres.Socket); err != nil {
+		problems = append(problems, "postgres.socket \""+postgres.Socket+"\" does not exist")
+	}
+	check(postgres.Database != "", "postgres.database is required")
+	check(postgres.Username != "", "postgres.username is required")
+	switch postgres.SslMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		problems = append(problems, "postgres.sslMode must be one of disable, require, verify-ca, verify-full, got \""+postgres.SslMode+"\"")
+	}
+	check((postgres.SslCert == "") == (postgres.SslKey == ""), "postgres.sslCert and postgres.sslKey must be set together")
+	problems = append(problems, checkFiles("postgres.", map[string]string{"sslRootCert": postgres.SslRootCert, "sslCert": postgres.SslCert, "sslKey": postgres.SslKey})...)
+	check(postgres.Timeout >= 0, "postgres.timeout cannot be negative")
+	problems = append(problems, validatePool("postgres.pool", postgres.Pool)...)
+	problems = append(problems, validateConnectRetry("postgres.retry", postgres.Retry)...)
+	return problems
+}
+
+// Validates the "sqlite" settings, used when "driver" is "sqlite"
+//
+// Parameters:
+//   - sqlite (types.AppConfigSqlite) : Settings to validate
+//
+// Returns:
+//   - []string : Every problem found
+func validateSqlite(sqlite types.AppConfigSqlite) []string {
+	var problems []string
+	if sqlite.Path == "" {
+		problems = append(problems, "sqlite.path is required")
+	} else if sqlite.Path == ":memory:" {
+		// Each connection and each command (EG: "migrate", "enqueue") would open its own empty database
+		problems = append(problems, "sqlite.path cannot be \":memory:\", the queue must be stored on a database file")
+	} else if _, err := os.Stat(filepath.Dir(sqlite.Path)); err != nil {
+		problems = append(problems, "sqlite.path directory \""+filepath.Dir(sqlite.Path)+"\" does not exist")
+	}
+	if sqlite.BusyTimeout < 0 {
+		problems = append(problems, "sqlite.busyTimeout cannot be negative")
+	}
+	switch strings.ToUpper(sqlite.JournalMode) {
+	case "", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF":
+	default:
+		problems = append(problems, "sqlite.journalMode must be one of DELETE, TRUNCATE, PERSIST, MEMORY, WAL, OFF, got \""+sqlite.JournalMode+"\"")
+	}
+	problems = append(problems, validatePool("sqlite.pool", sqlite.Pool)...)
+	problems = append(problems, validateConnectRetry("sqlite.retry", sqlite.Retry)...)
+	return problems
+}
+
+// Validates the "worker.queues" settings
+//
+// # Table and column names are written as is into the queue SQL statements, they are restricted to plain identifiers
+//
+// Parameters:
+//   - queues (map[string]types.AppConfigWorkerQueue) : Settings to validate, by queue name
+//
+// Returns:
+//   - []string : Every problem found, sorted by queue name
+func validateQueues(queues map[string]types.AppConfigWorkerQueue) []string {
+	var problems []string
+	var columns = QueueColumns()
+	var names = make([]string, 0, len(queues))
+	for name := range queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var tables = map[string]string{}
+	for _, name := range names {
+		var queue = queues[name]
+		var key = "worker.queues." + name
+		if !queueNamePattern.MatchString(name) {
+			problems = append(problems, key+" name can only hold letters, digits, \"_\" and \"-\" (up to 64 characters)")
+		}
+		if !tablePattern.MatchString(queue.Table) {
+			problems = append(problems, key+".table must be a table name (EG: report_jobs or reports.report_jobs), got \""+queue.Table+"\"")
+		} else if other, ok := tables[strings.ToLower(queue.Table)]; ok {
+			problems = append(problems, key+".table \""+queue.Table+"\" is already used by queue "+other)
+		} else {
+			tables[strings.ToLower(queue.Table)] = name
+		}
+		// Every column must resolve to a distinct name
+		var mapped = make([]string, 0, len(queue.Columns))
+		for column := range queue.Columns {
+			mapped = append(mapped, column)
+		}
+		sort.Strings(mapped)
+		for _, column := range mapped {
+			var valid = false
+			for _, known := range columns {
+				valid = valid || known == column
+			}
+			if !valid {
+				problems = append(problems, key+".columns."+column+" is not a queue column (valid columns: "+strings.Join(columns, ", ")+")")
+			} else if !columnPattern.MatchString(queue.Columns[column]) {
+				problems = append(problems, key+".columns."+column+" must be a column name, got \""+queue.Columns[column]+"\"")
+			}
+		}
+		var resolved = map[string]string{}
+		for _, column := range columns {
+			var actual = column
+			if queue.Columns[column] != "" {
+				actual = queue.Columns[column]
+			}
+			if other, ok := resolved[strings.ToLower(actual)]; ok {
+				problems = append(problems, key+".columns."+column+" and "+other+" both use column \""+actual+"\"")
+			}
+			resolved[strings.ToLower(actual)] = column
+		}
+		// Commands default to "worker.commands"
+		if queue.Commands.Single != "" {
+			problems = append(problems, validateCommand(key+".commands.single", queue.Commands.Single, 1)...)
+		}
+		if queue.Commands.Update != "" {
+			problems = append(problems, validateCommand(key+".commands.update", queue.Commands.Update, 1)...)
+		}
+	}
+	return problems
+}
+
+// Validates connection pool settings
+//
+// Parameters:
+//   - key (string) : Key of the pool settings, used on the reported problems
+//   - pool (types.AppConfigDatabasePool) : Settings to validate
+//
+// Returns:
+//   - []string : Every problem found
+func validatePool(key string, pool types.AppConfigDatabasePool) []string {
+	var problems []string
+	for name, value := range map[string]int{
+		"maxOpenConns":    pool.MaxOpenConns,
+		"maxIdleConns":    pool.MaxIdleConns,
+		"connMaxLifetime": pool.ConnMaxLifetime,
+		"connMaxIdleTime": pool.ConnMaxIdleTime,
+	} {
+		if value < 0 {
+			problems = append(problems, key+"."+name+" cannot be negative")
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// Validates connection retry settings
+//
+// Parameters:
+//   - key (string) : Key of the retry settings, used on the reported problems
+//   - retry (types.AppConfigDatabaseRetry) : Settings to validate
+//
+// Returns:
+//   - []string : Every problem found
+func validateConnectRetry(key string, retry types.AppConfigDatabaseRetry) []string {
+	var problems []string
+	if retry.Attempts <= 0 {
+		problems = append(problems, key+".attempts must be greater than 0")
+	}
+	if retry.Delay <= 0 {
+		problems = append(problems, key+".delay must be greater than 0")
+	}
+	if retry.MaxDelay < retry.Delay {
+		problems = append(problems, key+".maxDelay cannot be lower than "+key+".delay")
+	}
+	return problems
+}
+
+// Checks that the files given on settings exist, empty settings are skipped
+//
+// Parameters:
+//   - prefix (string) : Key prefix of the settings, used on the reported problems
+//   - files (map[string]string) : Location of each file, by setting name
+//
+// Returns:
+//   - []string : Every missing file, sorted by setting name
+func checkFiles(prefix string, files map[string]string) []string {
+	var problems []string
+	for name, file := range files {
+		if _, err := os.Stat(file); file != "" && err != nil {
+			problems = append(problems, prefix+name+" \""+file+"\" does not exist")
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// Validates a retry policy
+//
+// Parameters:
+//   - key (string) : Key of the policy, used on the reported problems
+//   - policy (types.AppConfigWorkerRetryPolicy) : Policy to validate
+//
+// Returns:
+//   - []string : Every problem found
+func validateRetryPolicy(key string, policy types.AppConfigWorkerRetryPolicy) []string {
+	var problems []string
+	if policy.MaxAttempts < 0 {
+		problems = append(problems, key+".maxAttempts cannot be negative")
+	}
+	if policy.Delay < 0 {
+		problems = append(problems, key+".delay cannot be negative")
+	}
+	if policy.Multiplier < 1 {
+		problems = append(problems, key+".multiplier must be at least 1")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		problems = append(problems, key+".jitter must be between 0 and 1")
+	}
+	// A maximum delay of 0 leaves the delay uncapped
+	if policy.MaxDelay < 0 {
+		problems = append(problems, key+".maxDelay cannot be negative")
+	} else if policy.MaxDelay > 0 && policy.MaxDelay < policy.Delay {
+		problems = append(problems, key+".maxDelay cannot be lower than "+key+".delay")
+	}
+	return problems
+}
+
+// Merges a query retry policy override into the default policy, keys missing from the override are taken from the
+// default policy (a key set to 0 is kept, EG: "maxAttempts": 0 disables retries of the query)
+//
+// Parameters:
+//   - policy (types.AppConfigWorkerRetryPolicy) : Default policy
+//   - override (types.AppConfigWorkerRetryOverride) : Query policy override
+//
+// Returns:
+//   - types.AppConfigWorkerRetryPolicy : Merged policy
+func MergeRetryPolicy(policy types.AppConfigWorkerRetryPolicy, override types.AppConfigWorkerRetryOverride) types.AppConfigWorkerRetryPolicy {
+	if override.MaxAttempts != nil {
+		policy.MaxAttempts = *override.MaxAttempts
+	}
+	if override.Delay != nil {
+		policy.Delay = *override.Delay
+	}
+	if override.Multiplier != nil {
+		policy.Multiplier = *override.Multiplier
+	}
+	if override.Jitter != nil {
+		policy.Jitter = *override.Jitter
+	}
+	if override.MaxDelay != nil {
+		policy.MaxDelay = *override.MaxDelay
+	}
+	return policy
+}
+
+// Validates a command template
+//
+// Parameters:
+//   - key (string) : Key of the command, used on the reported problems
+//   - command (string) : Command template
+//   - placeholders (int) : Number of "%s" placeholders the command must hold
+//
+// Returns:
+//   - []string : Every problem found
+func validateCommand(key string, command string, placeholders int) []string {
+	if strings.TrimSpace(command) == "" {
+		return []string{key + " is required"}
+	}
+	// Count formatting verbs, escaped "%%" are left out
+	var verbs, found = 0, 0
+	for i := 0; i < len(command); i++ {
+		if command[i] != '%' {
+			continue
+		}
+		if i+1 < len(command) && command[i+1] == '%' {
+			i++
+			continue
+		}
+		verbs++
+		if i+1 < len(command) && command[i+1] == 's' {
+			found++
+		}
+	}
+	if verbs != found {
+		return []string{key + " only accepts %s placeholders, use %% for a literal %"}
+	}
+	if found != placeholders {
+		return []string{key + " must hold " + strconv.Itoa(placeholders) + " %s placeholder(s) for the query signature, found " + strconv.Itoa(found)}
+	}
+	return nil
+}
+
+// Checks that an executable exists and can be run
+//
+// Parameters:
+//   - executable (string) : Path of the executable, or a name looked up on the PATH
+//
+// Returns:
+//   - string : Problem found, empty when the executable can be run
+func checkExecutable(executable string) string {
+	if executable == "" {
+		return "is required"
+	}
+	if !strings.Contains(executable, "/") {
+		if _, err := exec.LookPath(executable); err != nil {
+			return "\"" + executable + "\" was not found on the PATH"
+		}
+		return ""
+	}
+	info, err := os.Stat(executable)
+	if err != nil {
+		return "\"" + executable + "\" does not exist"
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return "\"" + executable + "\" is not executable"
+	}
+	return ""
+}
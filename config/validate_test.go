@@ -0,0 +1,166 @@
+package config
+
+import (
+	"github.com/creasty/defaults"
+	"query-queue-worker/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeRetryPolicy(t *testing.T) {
+	var zero, three, delay, maxDelay = 0, 3, 10, 600
+	var multiplier, jitter = 1.5, 0.0
+	var policy = types.AppConfigWorkerRetryPolicy{MaxAttempts: 5, Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 3600}
+	var tests = []struct {
+		name     string
+		override types.AppConfigWorkerRetryOverride
+		merged   types.AppConfigWorkerRetryPolicy
+	}{
+		{"empty override", types.AppConfigWorkerRetryOverride{}, policy},
+		{"maxAttempts", types.AppConfigWorkerRetryOverride{MaxAttempts: &three}, types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 3600}},
+		{"maxAttempts 0 disables retries", types.AppConfigWorkerRetryOverride{MaxAttempts: &zero}, types.AppConfigWorkerRetryPolicy{MaxAttempts: 0, Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 3600}},
+		{"jitter 0", types.AppConfigWorkerRetryOverride{Jitter: &jitter}, types.AppConfigWorkerRetryPolicy{MaxAttempts: 5, Delay: 60, Multiplier: 2, Jitter: 0, MaxDelay: 3600}},
+		{"every key", types.AppConfigWorkerRetryOverride{MaxAttempts: &three, Delay: &delay, Multiplier: &multiplier, Jitter: &jitter, MaxDelay: &maxDelay}, types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 10, Multiplier: 1.5, Jitter: 0, MaxDelay: 600}},
+	}
+	for _, test := range tests {
+		if merged := MergeRetryPolicy(policy, test.override); merged != test.merged {
+			t.Errorf("%s: MergeRetryPolicy = %+v, want %+v", test.name, merged, test.merged)
+		}
+	}
+}
+
+func TestValidateRetryPolicy(t *testing.T) {
+	var tests = []struct {
+		policy   types.AppConfigWorkerRetryPolicy
+		problems []string
+	}{
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 3600}, nil},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 0, Delay: 0, Multiplier: 1, Jitter: 1, MaxDelay: 0}, nil},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: -1, Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 3600}, []string{"retry.maxAttempts cannot be negative"}},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 60, Multiplier: 0.5, Jitter: 0.1, MaxDelay: 3600}, []string{"retry.multiplier must be at least 1"}},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 60, Multiplier: 2, Jitter: 1.5, MaxDelay: 3600}, []string{"retry.jitter must be between 0 and 1"}},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 60, Multiplier: 2, Jitter: -0.1, MaxDelay: 3600}, []string{"retry.jitter must be between 0 and 1"}},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 30}, []string{"retry.maxDelay cannot be lower than retry.delay"}},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: -1, Multiplier: 2, Jitter: 0.1, MaxDelay: 3600}, []string{"retry.delay cannot be negative"}},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 0}, nil},
+		{types.AppConfigWorkerRetryPolicy{MaxAttempts: 3, Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: -1}, []string{"retry.maxDelay cannot be negative"}},
+	}
+	for _, test := range tests {
+		if problems := validateRetryPolicy("retry", test.policy); !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("validateRetryPolicy(%+v) = %q, want %q", test.policy, problems, test.problems)
+		}
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	var tests = []struct {
+		command      string
+		placeholders int
+		problems     []string
+	}{
+		{"php run.php %s", 1, nil},
+		{"php run.php --progress=100%% %s", 1, nil},
+		{"php maintenance.php", 0, nil},
+		{"", 1, []string{"cmd is required"}},
+		{"   ", 1, []string{"cmd is required"}},
+		{"php run.php", 1, []string{"cmd must hold 1 %s placeholder(s) for the query signature, found 0"}},
+		{"php run.php %s %s", 1, []string{"cmd must hold 1 %s placeholder(s) for the query signature, found 2"}},
+		{"php run.php %d", 1, []string{"cmd only accepts %s placeholders, use %% for a literal %"}},
+		{"php run.php %s 100%", 1, []string{"cmd only accepts %s placeholders, use %% for a literal %"}},
+	}
+	for _, test := range tests {
+		if problems := validateCommand("cmd", test.command, test.placeholders); !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("validateCommand(%q, %d) = %q, want %q", test.command, test.placeholders, problems, test.problems)
+		}
+	}
+}
+
+func TestValidateQueues(t *testing.T) {
+	var tests = []struct {
+		name     string
+		queues   map[string]types.AppConfigWorkerQueue
+		problems []string
+	}{
+		{
+			"valid queues",
+			map[string]types.AppConfigWorkerQueue{
+				"reports": {Table: "reports.report_jobs", Columns: map[string]string{"runStatus": "state"}},
+				"exports": {Table: "export_jobs", Commands: types.AppConfigWorkerQueueCommands{Single: "php export.php %s"}},
+			},
+			nil,
+		},
+		{
+			"bad name and table",
+			map[string]types.AppConfigWorkerQueue{"bad name": {Table: "1jobs"}},
+			[]string{
+				`worker.queues.bad name name can only hold letters, digits, "_" and "-" (up to 64 characters)`,
+				`worker.queues.bad name.table must be a table name (EG: report_jobs or reports.report_jobs), got "1jobs"`,
+			},
+		},
+		{
+			"duplicate tables",
+			map[string]types.AppConfigWorkerQueue{
+				"a": {Table: "jobs"},
+				"b": {Table: "JOBS"},
+			},
+			[]string{`worker.queues.b.table "JOBS" is already used by queue a`},
+		},
+		{
+			"unknown and invalid columns",
+			map[string]types.AppConfigWorkerQueue{
+				"a": {Table: "jobs", Columns: map[string]string{"state": "status", "runError": "error message"}},
+			},
+			[]string{
+				`worker.queues.a.columns.runError must be a column name, got "error message"`,
+				"worker.queues.a.columns.state is not a queue column (valid columns: " + strings.Join(QueueColumns(), ", ") + ")",
+			},
+		},
+		{
+			"columns sharing a name",
+			map[string]types.AppConfigWorkerQueue{
+				"a": {Table: "jobs", Columns: map[string]string{"runError": "runStatus"}},
+			},
+			[]string{`worker.queues.a.columns.runError and runStatus both use column "runStatus"`},
+		},
+		{
+			"bad commands",
+			map[string]types.AppConfigWorkerQueue{
+				"a": {Table: "jobs", Commands: types.AppConfigWorkerQueueCommands{Single: "php run.php", Update: "php run.php %d"}},
+			},
+			[]string{
+				"worker.queues.a.commands.single must hold 1 %s placeholder(s) for the query signature, found 0",
+				"worker.queues.a.commands.update only accepts %s placeholders, use %% for a literal %",
+			},
+		},
+	}
+	for _, test := range tests {
+		if problems := validateQueues(test.queues); !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s: validateQueues = %q, want %q", test.name, problems, test.problems)
+		}
+	}
+}
+
+func TestValidateSqlite(t *testing.T) {
+	var directory = t.TempDir()
+	var tests = []struct {
+		name    string
+		path    string
+		problem string
+	}{
+		{"database file", directory + "/queue.db", ""},
+		{"missing path", "", "sqlite.path is required"},
+		{"in-memory database", ":memory:", `sqlite.path cannot be ":memory:", the queue must be stored on a database file`},
+		{"missing directory", directory + "/missing/queue.db", `sqlite.path directory "` + directory + `/missing" does not exist`},
+	}
+	for _, test := range tests {
+		var sqlite = types.AppConfigSqlite{}
+		defaults.Set(&sqlite)
+		sqlite.Path = test.path
+		var problems = validateSqlite(sqlite)
+		var problem = strings.Join(problems, "; ")
+		if problem != test.problem {
+			t.Errorf("%s: validateSqlite problems = %q, want %q", test.name, problem, test.problem)
+		}
+	}
+}
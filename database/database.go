@@ -1,33 +1,66 @@
-// Package database connects and provides MYSQL database connection
+// Package database connects and provides the SQL database connection (MYSQL, PostgreSQL or SQLite, from the "driver"
+// setting) along with the SQL dialect of its server
 package database
 
 import (
 	"database/sql"
-	"fmt"
-	_ "github.com/go-sql-driver/mysql"
 	"query-queue-worker/config"
+	"query-queue-worker/log"
 	"query-queue-worker/util"
+	"time"
 )
 
 // SQL Connection to the server
 var Con *sql.DB
 
-// Opens a new connection to MYSQL server
+// Opens a new connection to the database server of the "driver" setting, waiting for it to be reachable
 func Load() {
+	// Select SQL dialect
+	dialect, err := dialectOf(config.Settings.Driver)
+	if err != nil {
+		util.Die("Error: cannot configure database connection\n %v\n", err.Error())
+	}
+	Sql = dialect
 	// Build conn string
-	var dsn = fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s",
-		config.Settings.Mysql.Username,
-		config.Settings.Mysql.Password,
-		config.Settings.Mysql.Hostname,
-		config.Settings.Mysql.Port,
-		config.Settings.Mysql.Database,
-	)
-	db, err := sql.Open("mysql", dsn)
+	dsn, err := Sql.Dsn()
+	if err != nil {
+		util.Die("Error: cannot configure "+Sql.Name()+" connection\n %v\n", err.Error())
+	}
+	db, err := sql.Open(Sql.Driver(), dsn)
 	Con = db
 	if err != nil {
-		util.Die("Error: cannot connect to MYSQL\n %v\n", err.Error())
+		util.Die("Error: cannot connect to "+Sql.Name()+"\n %v\n", err.Error())
+	}
+	// Recycle connections before the server closes them (wait_timeout), which would otherwise end in mysql eof errors
+	var pool = Sql.Pool()
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Second * time.Duration(pool.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Second * time.Duration(pool.ConnMaxIdleTime))
+	// Wait for the server to be reachable
+	if err = ping(); err != nil {
+		util.Die("Error: cannot connect to "+Sql.Name()+"\n %v\n", err.Error())
+	}
+}
+
+// Pings the server, retrying with an exponential backoff up to "<driver>.retry.attempts" times
+//
+// Returns:
+//   - error : Last ping error, when every attempt failed
+func ping() error {
+	var retry = Sql.Retry()
+	var delay = time.Second * time.Duration(retry.Delay)
+	var maxDelay = time.Second * time.Duration(retry.MaxDelay)
+	for attempt := 1; ; attempt++ {
+		err := Con.Ping()
+		if err == nil || attempt >= retry.Attempts {
+			return err
+		}
+		log.Writer.Warnf("Cannot reach %s (attempt %d of %d), retrying in %v: %v", Sql.Name(), attempt, retry.Attempts, delay, err.Error())
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
 	}
-	// Set max idle conns on db in order to prevent packages.go mysql eof error
-	db.SetMaxIdleConns(0)
 }
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"query-queue-worker/types"
+)
+
+// Dialect builds the SQL that differs between the supported database servers
+//
+// Queries are written with "?" placeholders and portable SQL (COALESCE, CASE, CURRENT_TIMESTAMP), the dialect rewrites
+// placeholders and provides the date arithmetic, text conversion, upsert and locking syntax of its server
+type Dialect interface {
+	// Returns the dialect name, also the name of its migrations directory (EG: "mysql")
+	Name() string
+	// Returns the database/sql driver name
+	Driver() string
+	// Builds the driver connection string from the dialect settings
+	Dsn() (string, error)
+	// Returns the connection pool settings of the dialect
+	Pool() types.AppConfigDatabasePool
+	// Returns the connection retry settings of the dialect
+	Retry() types.AppConfigDatabaseRetry
+	// Rewrites the "?" placeholders of a query into the driver placeholders
+	Rebind(query string) string
+	// Returns the SQL expression of a date shifted by a "?" parameter amount of a unit (SECOND, MICROSECOND or DAY)
+	AddInterval(expr string, unit string) string
+	// Returns the SQL expression of the whole seconds elapsed between a date and now
+	SecondsSince(expr string) string
+	// Returns the SQL expression of the integer division of two integer expressions
+	IntDiv(dividend string, divisor string) string
+	// Returns the SQL expression of the greatest of several values
+	Greatest(exprs ...string) string
+	// Returns the SQL expression of several values concatenated as text
+	Concat(exprs ...string) string
+	// Returns the SQL expression of a value converted to text (EG: dates as "2006-01-02 15:04:05")
+	Text(expr string) string
+	// Returns the SQL expression of the current time with millisecond precision
+	NowPrecise() string
+	// Returns the clause turning an INSERT into an update of the row holding the same keys
+	Upsert(keys ...string) string
+	// Returns the SQL expression of a column value the upsert tried to insert
+	Inserted(column string) string
+	// Returns the clause locking selected rows while skipping the ones locked by other transactions
+	SkipLocked() string
+	// Returns the clause locking selected rows, waiting for the ones locked by other transactions
+	ForUpdate() string
+	// Returns the column type holding a date and time
+	DatetimeType() string
+}
+
+// SQL dialect of the "driver" setting
+var Sql Dialect
+
+// Returns the dialect of a driver
+//
+// Parameters:
+//   - driver (string) : The "driver" setting (mysql, postgres, sqlite)
+//
+// Returns:
+//   - Dialect : Dialect of the driver
+//   - error : Set when the driver is not supported
+func dialectOf(driver string) (Dialect, error) {
+	switch driver {
+	case "mysql":
+		return mysqlDialect{}, nil
+	case "postgres":
+		return postgresDialect{}, nil
+	case "sqlite":
+		return sqliteDialect{}, nil
+	}
+	return nil, errors.New("unsupported driver \"" + driver + "\"")
+}
+
+// Executes a query written with "?" placeholders
+func Exec(query string, args ...interface{}) (sql.Result, error) {
+	return Con.Exec(Sql.Rebind(query), args...)
+}
+
+// Runs a query written with "?" placeholders
+func Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return Con.Query(Sql.Rebind(query), args...)
+}
+
+// Runs a query written with "?" placeholders, returning at most one row
+func QueryRow(query string, args ...interface{}) *sql.Row {
+	return Con.QueryRow(Sql.Rebind(query), args...)
+}
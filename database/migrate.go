@@ -0,0 +1,260 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"query-queue-worker/config"
+	"query-queue-worker/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// Table recording the applied migration versions
+const schemaTable = "tblCRQueryQueueSchema"
+
+// Migration revert deleting rows, refused unless forced
+type revertLoss struct {
+	query string // Counts the rows the revert deletes
+	rows  string // Description of the deleted rows
+}
+
+// Migration reverts deleting rows, by version
+var revertLosses = map[int]revertLoss{
+	10: {"SELECT COUNT(*) FROM tblCRQueryQueueQuarantine WHERE queueName != {queue}", "quarantined queries of other queues"},
+}
+
+// Returns the embedded migrations of the current dialect sorted by version
+//
+// Each dialect has its own migrations directory (EG: "migrations/postgres") holding the same versions. Migration files are named "<version>_<name>.up.sql" and "<version>_<name>.down.sql", statements on a file are
+// separated by a semicolon at the end of a line. "{queue}" is replaced by the queue of the rows written before queues
+// were configurable, as a SQL string (see legacyQueue)
+func Migrations() ([]types.DatabaseMigration, error) {
+	entries, err := migrationFiles.ReadDir("migrations/" + Sql.Name())
+	if err != nil {
+		return nil, err
+	}
+	var byVersion = map[int]*types.DatabaseMigration{}
+	for _, entry := range entries {
+		var fileName = entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		var base = strings.TrimSuffix(fileName, "."+direction+".sql")
+		var parts = strings.SplitN(base, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, errors.New("invalid migration file name \"" + fileName + "\"")
+		}
+		content, err := migrationFiles.ReadFile("migrations/" + Sql.Name() + "/" + fileName)
+		if err != nil {
+			return nil, err
+		}
+		if byVersion[version] == nil {
+			byVersion[version] = &types.DatabaseMigration{Version: version, Name: parts[1]}
+		}
+		if direction == "up" {
+			byVersion[version].Up = string(content)
+		} else {
+			byVersion[version].Down = string(content)
+		}
+	}
+	var migrations []types.DatabaseMigration
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Returns every embedded migration along with the time it was applied, when it was
+func MigrationStatus() ([]types.DatabaseMigration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	for i := range migrations {
+		migrations[i].AppliedAt = applied[migrations[i].Version]
+	}
+	return migrations, nil
+}
+
+// Applies pending migrations in version order
+//
+// Parameters:
+//   - steps (int) : Maximum number of migrations to apply, 0 to apply all of them
+//
+// Returns:
+//   - []types.DatabaseMigration : Migrations that were applied
+//   - error : Set when a migration fails, previous migrations stay applied
+func MigrateUp(steps int) ([]types.DatabaseMigration, error) {
+	migrations, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var done []types.DatabaseMigration
+	for _, migration := range migrations {
+		if migration.AppliedAt != "" {
+			continue
+		}
+		if steps > 0 && len(done) >= steps {
+			break
+		}
+		if err = execStatements(migration.Up); err != nil {
+			return done, fmt.Errorf("migration %04d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		_, err = Exec("INSERT INTO "+schemaTable+" (version, name) VALUES (?, ?)", migration.Version, migration.Name)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Reverts applied migrations in reverse version order
+//
+// Parameters:
+//   - steps (int) : Number of migrations to revert
+//   - force (bool) : Weather to revert migrations that delete rows, they are refused otherwise
+//
+// Returns:
+//   - []types.DatabaseMigration : Migrations that were reverted
+//   - error : Set when a migration fails or is refused, previous migrations stay reverted
+func MigrateDown(steps int, force bool) ([]types.DatabaseMigration, error) {
+	migrations, err := MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var done []types.DatabaseMigration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		var migration = migrations[i]
+		if migration.AppliedAt == "" {
+			continue
+		}
+		// Refuse reverts that would delete rows unless forced
+		if loss, ok := revertLosses[migration.Version]; ok && !force {
+			var count int
+			if err = QueryRow(expandQueue(loss.query)).Scan(&count); err != nil {
+				return done, err
+			}
+			if count > 0 {
+				return done, fmt.Errorf("reverting migration %04d_%s deletes %d %s, run again with --force to revert it anyway", migration.Version, migration.Name, count, loss.rows)
+			}
+		}
+		if err = execStatements(migration.Down); err != nil {
+			return done, fmt.Errorf("migration %04d_%s revert failed: %v", migration.Version, migration.Name, err)
+		}
+		_, err = Exec("DELETE FROM "+schemaTable+" WHERE version = ?", migration.Version)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Checks weather every embedded migration was applied
+//
+// Returns:
+//   - error : Describes the missing migrations, nil when the schema is up to date
+func CheckSchema() error {
+	migrations, err := MigrationStatus()
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, migration := range migrations {
+		if migration.AppliedAt == "" {
+			missing = append(missing, fmt.Sprintf("%04d_%s", migration.Version, migration.Name))
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("database schema is behind, missing migrations: " + strings.Join(missing, ", ") + ". Run \"query-queue-worker migrate up\"")
+	}
+	return nil
+}
+
+// Returns the applied migration versions and the time they were applied, creating the schema table when missing
+func appliedMigrations() (map[int]string, error) {
+	var query = `
+		CREATE TABLE IF NOT EXISTS ` + schemaTable + `
+		(
+			version INT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			appliedAt ` + Sql.DatetimeType() + ` DEFAULT CURRENT_TIMESTAMP NOT NULL
+		)`
+	if _, err := Con.Exec(query); err != nil {
+		return nil, err
+	}
+	results, err := Con.Query("SELECT version, " + Sql.Text("appliedAt") + " FROM " + schemaTable)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	var applied = map[int]string{}
+	for results.Next() {
+		var version int
+		var appliedAt string
+		if err = results.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, results.Err()
+}
+
+// Executes the statements of a migration file one by one
+func execStatements(content string) error {
+	for _, statement := range splitStatements(content) {
+		if _, err := Con.Exec(expandQueue(statement)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Splits the content of a migration file into statements, separated by a semicolon at the end of a line
+func splitStatements(content string) []string {
+	var statements []string
+	for _, statement := range strings.Split(content, ";\n") {
+		statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+		if statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// Replaces "{queue}" on a migration statement by the queue of the rows written before queues were configurable
+func expandQueue(statement string) string {
+	return strings.ReplaceAll(statement, "{queue}", "'"+legacyQueue()+"'")
+}
+
+// Returns the queue of the rows written before queues were configurable, the queue processing the "tblCRQueryQueue"
+// table or, when none does, the default queue. Queue names are validated by the config as plain names
+func legacyQueue() string {
+	var queues = config.Queues()
+	for _, name := range config.QueueNames() {
+		if strings.EqualFold(queues[name].Table, config.DefaultTable) {
+			return name
+		}
+	}
+	return config.QueueNames()[0]
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"github.com/creasty/defaults"
+	"path/filepath"
+	"query-queue-worker/config"
+	"query-queue-worker/log"
+	"query-queue-worker/types"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	var names []string
+	for _, dialect := range []Dialect{mysqlDialect{}, postgresDialect{}, sqliteDialect{}} {
+		Sql = dialect
+		migrations, err := Migrations()
+		if err != nil {
+			t.Fatalf("%s: Migrations returned error: %v", dialect.Name(), err)
+		}
+		var dialectNames []string
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Errorf("%s: migration %d has version %d, versions must follow each other from 1", dialect.Name(), i, migration.Version)
+			}
+			if len(splitStatements(migration.Up)) == 0 || len(splitStatements(migration.Down)) == 0 {
+				t.Errorf("%s: migration %04d_%s is missing its up or down statements", dialect.Name(), migration.Version, migration.Name)
+			}
+			dialectNames = append(dialectNames, migration.Name)
+		}
+		if names != nil && !reflect.DeepEqual(dialectNames, names) {
+			t.Errorf("%s: migrations = %v, want the migrations of the other dialects %v", dialect.Name(), dialectNames, names)
+		}
+		names = dialectNames
+		// The queue table may predate the migrations, reverting them must keep its jobs
+		if strings.Contains(strings.ToUpper(migrations[0].Down), "DROP TABLE") {
+			t.Errorf("%s: migration 0001 drops the queue table on revert", dialect.Name())
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	var tests = []struct {
+		content    string
+		statements []string
+	}{
+		{"", nil},
+		{"SELECT 1;", []string{"SELECT 1"}},
+		{"SELECT 1;\nSELECT 2;\n", []string{"SELECT 1", "SELECT 2"}},
+		{"-- Comment\nSELECT 1;\n\n", []string{"-- Comment\nSELECT 1"}},
+		{"CREATE TABLE t\n(\n    a INT,\n    b TEXT DEFAULT ';'\n);\nCREATE INDEX i ON t (a);", []string{"CREATE TABLE t\n(\n    a INT,\n    b TEXT DEFAULT ';'\n)", "CREATE INDEX i ON t (a)"}},
+		{"UPDATE t SET a = 1;  \n  ;\nSELECT 1", []string{"UPDATE t SET a = 1", "SELECT 1"}},
+	}
+	for _, test := range tests {
+		if statements := splitStatements(test.content); !reflect.DeepEqual(statements, test.statements) {
+			t.Errorf("splitStatements(%q) = %q, want %q", test.content, statements, test.statements)
+		}
+	}
+}
+
+// Opens an empty SQLite database on a temporary file
+func openDatabase(t *testing.T, queues map[string]types.AppConfigWorkerQueue) {
+	config.Settings = types.AppConfig{}
+	defaults.Set(&config.Settings)
+	config.Settings.Driver = "sqlite"
+	config.Settings.Sqlite.Path = filepath.Join(t.TempDir(), "queue.db")
+	config.Settings.Worker.Queues = queues
+	log.Init(&config.Settings, true)
+	Load()
+	t.Cleanup(func() {
+		Con.Close()
+	})
+}
+
+func TestMigrateDownKeepsQueueTable(t *testing.T) {
+	openDatabase(t, nil)
+	applied, err := MigrateUp(0)
+	if err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	if _, err = Exec("INSERT INTO tblCRQueryQueue (querySignature, queryName) VALUES (?, ?)", "5f2b", "q"); err != nil {
+		t.Fatalf("cannot insert row: %v", err)
+	}
+	if _, err = MigrateDown(len(applied), false); err != nil {
+		t.Fatalf("MigrateDown returned error: %v", err)
+	}
+	var count int
+	if err = QueryRow("SELECT COUNT(*) FROM tblCRQueryQueue").Scan(&count); err != nil {
+		t.Fatalf("cannot count rows after reverting every migration: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("queue table holds %d rows after reverting every migration, want 1", count)
+	}
+	// Migrating again adopts the kept table
+	if _, err = MigrateUp(0); err != nil {
+		t.Fatalf("MigrateUp on the kept table returned error: %v", err)
+	}
+	if err = CheckSchema(); err != nil {
+		t.Errorf("CheckSchema returned error: %v", err)
+	}
+}
+
+func TestQueueNameMigration(t *testing.T) {
+	// The queue of tblCRQueryQueue is not the default queue, which is the first by name
+	openDatabase(t, map[string]types.AppConfigWorkerQueue{
+		"archive": {Table: "archive_jobs"},
+		"main":    {Table: "tblCRQueryQueue"},
+	})
+	if _, err := MigrateUp(9); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	var statements = []string{
+		"INSERT INTO tblCRQueryQueueQuarantine (querySignature, queryName, processType, failures) VALUES ('5f2b', 'q', 'Pending', 3)",
+		"INSERT INTO tblCRQueryQueueRun (querySignature, queryName, processType, workerId, threadId, runStatus, startedAt, endedAt, durationMs) VALUES ('5f2b', 'q', 'Pending', 'w', 1, 'failed', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 0)",
+	}
+	for _, statement := range statements {
+		if _, err := Exec(statement); err != nil {
+			t.Fatalf("cannot insert row: %v", err)
+		}
+	}
+	if _, err := MigrateUp(1); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	// Rows written before the migration belong to the queue of tblCRQueryQueue
+	for _, table := range []string{"tblCRQueryQueueQuarantine", "tblCRQueryQueueRun"} {
+		var queue string
+		if err := QueryRow("SELECT queueName FROM " + table).Scan(&queue); err != nil {
+			t.Fatalf("cannot read %s: %v", table, err)
+		}
+		if queue != "main" {
+			t.Errorf("%s queueName = %q, want \"main\"", table, queue)
+		}
+	}
+	// Reverting deletes the quarantined queries of other queues, it is refused unless forced
+	if _, err := Exec("INSERT INTO tblCRQueryQueueQuarantine (queueName, querySignature, queryName, processType, failures) VALUES ('archive', '5f2b', 'q', 'Pending', 3)"); err != nil {
+		t.Fatalf("cannot insert row: %v", err)
+	}
+	if reverted, err := MigrateDown(1, false); err == nil || len(reverted) != 0 {
+		t.Fatalf("MigrateDown = %v, %v, want the revert refused", reverted, err)
+	}
+	if _, err := MigrateDown(1, true); err != nil {
+		t.Fatalf("MigrateDown forced returned error: %v", err)
+	}
+	var count int
+	if err := QueryRow("SELECT COUNT(*) FROM tblCRQueryQueueQuarantine").Scan(&count); err != nil {
+		t.Fatalf("cannot count quarantined queries: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("quarantine holds %d rows after the revert, want the 1 row of the main queue", count)
+	}
+}
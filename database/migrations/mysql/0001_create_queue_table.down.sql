@@ -0,0 +1,2 @@
+-- The queue table may predate the migrations and hold the production jobs, it is kept. Drop it by hand when needed
+SELECT 1;
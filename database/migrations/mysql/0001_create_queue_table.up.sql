@@ -1,4 +1,5 @@
-CREATE TABLE tblCRQueryQueue
+-- Adopts the queue table of existing installs as is, later migrations add the columns the worker needs
+CREATE TABLE IF NOT EXISTS tblCRQueryQueue
 (
     pkQueryQueueID INT AUTO_INCREMENT PRIMARY KEY,
     runStatus ENUM ('pending', 'processing', 'completed', 'failed') DEFAULT 'pending' NOT NULL,
@@ -10,4 +11,4 @@ CREATE TABLE tblCRQueryQueue
     runNext DATETIME NULL,
     queryName TINYTEXT NOT NULL,
     querySignature VARCHAR(35) NOT NULL
-);
\ No newline at end of file
+);
@@ -0,0 +1,5 @@
+ALTER TABLE tblCRQueryQueue
+    DROP COLUMN claimedBy,
+    DROP COLUMN claimedAt,
+    DROP COLUMN leaseExpires,
+    DROP COLUMN recoveries;
@@ -0,0 +1,5 @@
+ALTER TABLE tblCRQueryQueue
+    ADD COLUMN claimedBy VARCHAR(100) NULL,
+    ADD COLUMN claimedAt DATETIME NULL,
+    ADD COLUMN leaseExpires DATETIME NULL,
+    ADD COLUMN recoveries INT DEFAULT 0 NOT NULL;
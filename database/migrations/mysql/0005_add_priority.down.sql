@@ -0,0 +1,3 @@
+ALTER TABLE tblCRQueryQueue
+    DROP INDEX idxRunStatusPriority,
+    DROP COLUMN priority;
@@ -0,0 +1,3 @@
+ALTER TABLE tblCRQueryQueue
+    ADD COLUMN priority INT DEFAULT 0 NOT NULL AFTER runStatus,
+    ADD INDEX idxRunStatusPriority (runStatus, priority);
@@ -0,0 +1,3 @@
+UPDATE tblCRQueryQueue SET runStatus = 'failed' WHERE runStatus = 'cancelled';
+ALTER TABLE tblCRQueryQueue
+    MODIFY COLUMN runStatus ENUM ('pending', 'processing', 'completed', 'failed') DEFAULT 'pending' NOT NULL;
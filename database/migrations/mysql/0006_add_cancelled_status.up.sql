@@ -0,0 +1,2 @@
+ALTER TABLE tblCRQueryQueue
+    MODIFY COLUMN runStatus ENUM ('pending', 'processing', 'completed', 'failed', 'cancelled') DEFAULT 'pending' NOT NULL;
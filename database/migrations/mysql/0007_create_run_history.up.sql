@@ -0,0 +1,17 @@
+CREATE TABLE tblCRQueryQueueRun
+(
+    pkQueryQueueRunID BIGINT AUTO_INCREMENT PRIMARY KEY,
+    querySignature VARCHAR(35) NOT NULL,
+    queryName TINYTEXT NOT NULL,
+    processType VARCHAR(20) NOT NULL,
+    workerId VARCHAR(100) NOT NULL,
+    threadId INT NOT NULL,
+    runStatus VARCHAR(20) NOT NULL,
+    exitCode INT NULL,
+    startedAt DATETIME(3) NOT NULL,
+    endedAt DATETIME(3) NOT NULL,
+    durationMs INT NOT NULL,
+    output TEXT NULL,
+    INDEX idxSignatureStartedAt (querySignature, startedAt),
+    INDEX idxStartedAt (startedAt)
+);
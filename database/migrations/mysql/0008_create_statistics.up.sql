@@ -0,0 +1,13 @@
+CREATE TABLE tblCRQueryQueueStats
+(
+    processType VARCHAR(20) NOT NULL,
+    queryName VARCHAR(255) NOT NULL,
+    total INT DEFAULT 0 NOT NULL,
+    successful INT DEFAULT 0 NOT NULL,
+    failed INT DEFAULT 0 NOT NULL,
+    timedOut INT DEFAULT 0 NOT NULL,
+    lastRun DATETIME NULL,
+    lastError TEXT NULL,
+    updatedAt DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (processType, queryName)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE tblCRQueryQueueQuarantine
+(
+    querySignature VARCHAR(35) NOT NULL PRIMARY KEY,
+    queryName TINYTEXT NOT NULL,
+    processType VARCHAR(20) NOT NULL,
+    failures INT DEFAULT 0 NOT NULL,
+    lastError TEXT NULL,
+    quarantinedAt DATETIME NULL,
+    releaseAt DATETIME NULL,
+    INDEX idxQuarantine (quarantinedAt, releaseAt)
+);
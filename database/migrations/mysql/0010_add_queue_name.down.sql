@@ -0,0 +1,9 @@
+DELETE FROM tblCRQueryQueueQuarantine WHERE queueName != {queue};
+ALTER TABLE tblCRQueryQueueQuarantine
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (querySignature),
+    DROP COLUMN queueName;
+ALTER TABLE tblCRQueryQueueRun
+    DROP INDEX idxQueueSignatureStartedAt,
+    ADD INDEX idxSignatureStartedAt (querySignature, startedAt),
+    DROP COLUMN queueName;
@@ -0,0 +1,10 @@
+ALTER TABLE tblCRQueryQueueRun
+    ADD COLUMN queueName VARCHAR(64) DEFAULT 'default' NOT NULL AFTER pkQueryQueueRunID,
+    DROP INDEX idxSignatureStartedAt,
+    ADD INDEX idxQueueSignatureStartedAt (queueName, querySignature, startedAt);
+UPDATE tblCRQueryQueueRun SET queueName = {queue};
+ALTER TABLE tblCRQueryQueueQuarantine
+    ADD COLUMN queueName VARCHAR(64) DEFAULT 'default' NOT NULL FIRST,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (queueName, querySignature);
+UPDATE tblCRQueryQueueQuarantine SET queueName = {queue};
@@ -0,0 +1,4 @@
+CREATE TABLE tblCRQueryQueueGroupLock
+(
+    groupName VARCHAR(64) NOT NULL PRIMARY KEY
+);
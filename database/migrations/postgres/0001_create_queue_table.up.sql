@@ -0,0 +1,15 @@
+-- Adopts the queue table of existing installs as is, later migrations add the columns the worker needs
+CREATE TABLE IF NOT EXISTS tblCRQueryQueue
+(
+    pkQueryQueueID SERIAL PRIMARY KEY,
+    runStatus VARCHAR(20) DEFAULT 'pending' NOT NULL,
+    runError TEXT NULL,
+    runTime INT DEFAULT 0 NULL,
+    runRepeat VARCHAR(50) NULL,
+    runFirst TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP NULL,
+    runLast TIMESTAMP(0) NULL,
+    runNext TIMESTAMP(0) NULL,
+    queryName TEXT NOT NULL,
+    querySignature VARCHAR(35) NOT NULL,
+    CONSTRAINT chkRunStatus CHECK (runStatus IN ('pending', 'processing', 'completed', 'failed'))
+);
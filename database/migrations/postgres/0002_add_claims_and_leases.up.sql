@@ -0,0 +1,5 @@
+ALTER TABLE tblCRQueryQueue
+    ADD COLUMN claimedBy VARCHAR(100) NULL,
+    ADD COLUMN claimedAt TIMESTAMP(0) NULL,
+    ADD COLUMN leaseExpires TIMESTAMP(0) NULL,
+    ADD COLUMN recoveries INT DEFAULT 0 NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE tblCRQueryQueue
+    ADD COLUMN runTimeout INT NULL;
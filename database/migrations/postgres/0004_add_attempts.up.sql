@@ -0,0 +1,2 @@
+ALTER TABLE tblCRQueryQueue
+    ADD COLUMN attempts INT DEFAULT 0 NOT NULL;
@@ -0,0 +1,4 @@
+UPDATE tblCRQueryQueue SET runStatus = 'failed' WHERE runStatus = 'cancelled';
+ALTER TABLE tblCRQueryQueue
+    DROP CONSTRAINT chkRunStatus,
+    ADD CONSTRAINT chkRunStatus CHECK (runStatus IN ('pending', 'processing', 'completed', 'failed'));
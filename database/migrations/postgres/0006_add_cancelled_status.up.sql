@@ -0,0 +1,3 @@
+ALTER TABLE tblCRQueryQueue
+    DROP CONSTRAINT chkRunStatus,
+    ADD CONSTRAINT chkRunStatus CHECK (runStatus IN ('pending', 'processing', 'completed', 'failed', 'cancelled'));
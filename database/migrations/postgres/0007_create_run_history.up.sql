@@ -0,0 +1,17 @@
+CREATE TABLE tblCRQueryQueueRun
+(
+    pkQueryQueueRunID BIGSERIAL PRIMARY KEY,
+    querySignature VARCHAR(35) NOT NULL,
+    queryName TEXT NOT NULL,
+    processType VARCHAR(20) NOT NULL,
+    workerId VARCHAR(100) NOT NULL,
+    threadId INT NOT NULL,
+    runStatus VARCHAR(20) NOT NULL,
+    exitCode INT NULL,
+    startedAt TIMESTAMP(3) NOT NULL,
+    endedAt TIMESTAMP(3) NOT NULL,
+    durationMs INT NOT NULL,
+    output TEXT NULL
+);
+CREATE INDEX idxSignatureStartedAt ON tblCRQueryQueueRun (querySignature, startedAt);
+CREATE INDEX idxStartedAt ON tblCRQueryQueueRun (startedAt);
@@ -0,0 +1,11 @@
+CREATE TABLE tblCRQueryQueueQuarantine
+(
+    querySignature VARCHAR(35) NOT NULL PRIMARY KEY,
+    queryName TEXT NOT NULL,
+    processType VARCHAR(20) NOT NULL,
+    failures INT DEFAULT 0 NOT NULL,
+    lastError TEXT NULL,
+    quarantinedAt TIMESTAMP(0) NULL,
+    releaseAt TIMESTAMP(0) NULL
+);
+CREATE INDEX idxQuarantine ON tblCRQueryQueueQuarantine (quarantinedAt, releaseAt);
@@ -0,0 +1,10 @@
+DELETE FROM tblCRQueryQueueQuarantine WHERE queueName != {queue};
+ALTER TABLE tblCRQueryQueueQuarantine
+    DROP CONSTRAINT tblCRQueryQueueQuarantine_pkey,
+    ADD PRIMARY KEY (querySignature);
+ALTER TABLE tblCRQueryQueueQuarantine
+    DROP COLUMN queueName;
+DROP INDEX idxQueueSignatureStartedAt;
+CREATE INDEX idxSignatureStartedAt ON tblCRQueryQueueRun (querySignature, startedAt);
+ALTER TABLE tblCRQueryQueueRun
+    DROP COLUMN queueName;
@@ -0,0 +1,11 @@
+ALTER TABLE tblCRQueryQueueRun
+    ADD COLUMN queueName VARCHAR(64) DEFAULT 'default' NOT NULL;
+UPDATE tblCRQueryQueueRun SET queueName = {queue};
+DROP INDEX idxSignatureStartedAt;
+CREATE INDEX idxQueueSignatureStartedAt ON tblCRQueryQueueRun (queueName, querySignature, startedAt);
+ALTER TABLE tblCRQueryQueueQuarantine
+    ADD COLUMN queueName VARCHAR(64) DEFAULT 'default' NOT NULL;
+UPDATE tblCRQueryQueueQuarantine SET queueName = {queue};
+ALTER TABLE tblCRQueryQueueQuarantine
+    DROP CONSTRAINT tblCRQueryQueueQuarantine_pkey,
+    ADD PRIMARY KEY (queueName, querySignature);
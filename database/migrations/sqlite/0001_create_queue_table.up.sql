@@ -0,0 +1,14 @@
+-- Adopts the queue table of existing installs as is, later migrations add the columns the worker needs
+CREATE TABLE IF NOT EXISTS tblCRQueryQueue
+(
+    pkQueryQueueID INTEGER PRIMARY KEY AUTOINCREMENT,
+    runStatus TEXT DEFAULT 'pending' NOT NULL,
+    runError TEXT NULL,
+    runTime INTEGER DEFAULT 0 NULL,
+    runRepeat TEXT NULL,
+    runFirst TEXT DEFAULT CURRENT_TIMESTAMP NULL,
+    runLast TEXT NULL,
+    runNext TEXT NULL,
+    queryName TEXT NOT NULL,
+    querySignature TEXT NOT NULL
+);
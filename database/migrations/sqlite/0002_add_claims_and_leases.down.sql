@@ -0,0 +1,4 @@
+ALTER TABLE tblCRQueryQueue DROP COLUMN claimedBy;
+ALTER TABLE tblCRQueryQueue DROP COLUMN claimedAt;
+ALTER TABLE tblCRQueryQueue DROP COLUMN leaseExpires;
+ALTER TABLE tblCRQueryQueue DROP COLUMN recoveries;
@@ -0,0 +1,4 @@
+ALTER TABLE tblCRQueryQueue ADD COLUMN claimedBy TEXT NULL;
+ALTER TABLE tblCRQueryQueue ADD COLUMN claimedAt TEXT NULL;
+ALTER TABLE tblCRQueryQueue ADD COLUMN leaseExpires TEXT NULL;
+ALTER TABLE tblCRQueryQueue ADD COLUMN recoveries INTEGER DEFAULT 0 NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE tblCRQueryQueue
+    DROP COLUMN runTimeout;
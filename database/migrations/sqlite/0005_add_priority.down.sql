@@ -0,0 +1,3 @@
+DROP INDEX idxRunStatusPriority;
+ALTER TABLE tblCRQueryQueue
+    DROP COLUMN priority;
@@ -0,0 +1,3 @@
+ALTER TABLE tblCRQueryQueue
+    ADD COLUMN priority INTEGER DEFAULT 0 NOT NULL;
+CREATE INDEX idxRunStatusPriority ON tblCRQueryQueue (runStatus, priority);
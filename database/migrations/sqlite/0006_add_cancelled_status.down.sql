@@ -0,0 +1 @@
+UPDATE tblCRQueryQueue SET runStatus = 'failed' WHERE runStatus = 'cancelled';
@@ -0,0 +1,2 @@
+-- "runStatus" is not constrained to a list of values on SQLite, "cancelled" requires no schema change
+SELECT 1;
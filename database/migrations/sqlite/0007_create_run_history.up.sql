@@ -0,0 +1,17 @@
+CREATE TABLE tblCRQueryQueueRun
+(
+    pkQueryQueueRunID INTEGER PRIMARY KEY AUTOINCREMENT,
+    querySignature TEXT NOT NULL,
+    queryName TEXT NOT NULL,
+    processType TEXT NOT NULL,
+    workerId TEXT NOT NULL,
+    threadId INTEGER NOT NULL,
+    runStatus TEXT NOT NULL,
+    exitCode INTEGER NULL,
+    startedAt TEXT NOT NULL,
+    endedAt TEXT NOT NULL,
+    durationMs INTEGER NOT NULL,
+    output TEXT NULL
+);
+CREATE INDEX idxSignatureStartedAt ON tblCRQueryQueueRun (querySignature, startedAt);
+CREATE INDEX idxStartedAt ON tblCRQueryQueueRun (startedAt);
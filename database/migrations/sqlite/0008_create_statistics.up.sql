@@ -0,0 +1,13 @@
+CREATE TABLE tblCRQueryQueueStats
+(
+    processType TEXT NOT NULL,
+    queryName TEXT NOT NULL,
+    total INTEGER DEFAULT 0 NOT NULL,
+    successful INTEGER DEFAULT 0 NOT NULL,
+    failed INTEGER DEFAULT 0 NOT NULL,
+    timedOut INTEGER DEFAULT 0 NOT NULL,
+    lastRun TEXT NULL,
+    lastError TEXT NULL,
+    updatedAt TEXT DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (processType, queryName)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE tblCRQueryQueueQuarantine
+(
+    querySignature TEXT NOT NULL PRIMARY KEY,
+    queryName TEXT NOT NULL,
+    processType TEXT NOT NULL,
+    failures INTEGER DEFAULT 0 NOT NULL,
+    lastError TEXT NULL,
+    quarantinedAt TEXT NULL,
+    releaseAt TEXT NULL
+);
+CREATE INDEX idxQuarantine ON tblCRQueryQueueQuarantine (quarantinedAt, releaseAt);
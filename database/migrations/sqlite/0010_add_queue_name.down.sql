@@ -0,0 +1,18 @@
+CREATE TABLE tblCRQueryQueueQuarantineOld
+(
+    querySignature TEXT NOT NULL PRIMARY KEY,
+    queryName TEXT NOT NULL,
+    processType TEXT NOT NULL,
+    failures INTEGER DEFAULT 0 NOT NULL,
+    lastError TEXT NULL,
+    quarantinedAt TEXT NULL,
+    releaseAt TEXT NULL
+);
+INSERT INTO tblCRQueryQueueQuarantineOld (querySignature, queryName, processType, failures, lastError, quarantinedAt, releaseAt)
+SELECT querySignature, queryName, processType, failures, lastError, quarantinedAt, releaseAt FROM tblCRQueryQueueQuarantine WHERE queueName = {queue};
+DROP TABLE tblCRQueryQueueQuarantine;
+ALTER TABLE tblCRQueryQueueQuarantineOld RENAME TO tblCRQueryQueueQuarantine;
+CREATE INDEX idxQuarantine ON tblCRQueryQueueQuarantine (quarantinedAt, releaseAt);
+DROP INDEX idxQueueSignatureStartedAt;
+CREATE INDEX idxSignatureStartedAt ON tblCRQueryQueueRun (querySignature, startedAt);
+ALTER TABLE tblCRQueryQueueRun DROP COLUMN queueName;
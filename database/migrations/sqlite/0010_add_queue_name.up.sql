@@ -0,0 +1,22 @@
+ALTER TABLE tblCRQueryQueueRun ADD COLUMN queueName TEXT DEFAULT 'default' NOT NULL;
+UPDATE tblCRQueryQueueRun SET queueName = {queue};
+DROP INDEX idxSignatureStartedAt;
+CREATE INDEX idxQueueSignatureStartedAt ON tblCRQueryQueueRun (queueName, querySignature, startedAt);
+-- SQLite cannot change a primary key, the quarantine table is rebuilt
+CREATE TABLE tblCRQueryQueueQuarantineNew
+(
+    queueName TEXT DEFAULT 'default' NOT NULL,
+    querySignature TEXT NOT NULL,
+    queryName TEXT NOT NULL,
+    processType TEXT NOT NULL,
+    failures INTEGER DEFAULT 0 NOT NULL,
+    lastError TEXT NULL,
+    quarantinedAt TEXT NULL,
+    releaseAt TEXT NULL,
+    PRIMARY KEY (queueName, querySignature)
+);
+INSERT INTO tblCRQueryQueueQuarantineNew (queueName, querySignature, queryName, processType, failures, lastError, quarantinedAt, releaseAt)
+SELECT {queue}, querySignature, queryName, processType, failures, lastError, quarantinedAt, releaseAt FROM tblCRQueryQueueQuarantine;
+DROP TABLE tblCRQueryQueueQuarantine;
+ALTER TABLE tblCRQueryQueueQuarantineNew RENAME TO tblCRQueryQueueQuarantine;
+CREATE INDEX idxQuarantine ON tblCRQueryQueueQuarantine (quarantinedAt, releaseAt);
@@ -0,0 +1,4 @@
+CREATE TABLE tblCRQueryQueueGroupLock
+(
+    groupName TEXT NOT NULL PRIMARY KEY
+);
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"io/ioutil"
+	"query-queue-worker/config"
+	"query-queue-worker/types"
+	"strings"
+	"time"
+)
+
+// Name under which the TLS configuration is registered on the MYSQL driver
+const tlsConfigName = "query-queue-worker"
+
+// SQL dialect of MYSQL servers (8.0 and above, MariaDB 10.6 and above, as "SKIP LOCKED" is required)
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Driver() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Dsn() (string, error) {
+	return buildDsn()
+}
+
+func (mysqlDialect) Pool() types.AppConfigDatabasePool {
+	return config.Settings.Mysql.Pool
+}
+
+func (mysqlDialect) Retry() types.AppConfigDatabaseRetry {
+	return config.Settings.Mysql.Retry
+}
+
+func (mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (mysqlDialect) AddInterval(expr string, unit string) string {
+	return "DATE_ADD(" + expr + ", INTERVAL ? " + unit + ")"
+}
+
+func (mysqlDialect) SecondsSince(expr string) string {
+	return "TIMESTAMPDIFF(SECOND, " + expr + ", CURRENT_TIMESTAMP)"
+}
+
+func (mysqlDialect) IntDiv(dividend string, divisor string) string {
+	return "(" + dividend + " DIV " + divisor + ")"
+}
+
+func (mysqlDialect) Greatest(exprs ...string) string {
+	return "GREATEST(" + strings.Join(exprs, ", ") + ")"
+}
+
+func (mysqlDialect) Concat(exprs ...string) string {
+	return "CONCAT(" + strings.Join(exprs, ", ") + ")"
+}
+
+func (mysqlDialect) Text(expr string) string {
+	return expr
+}
+
+func (mysqlDialect) NowPrecise() string {
+	return "NOW(3)"
+}
+
+func (mysqlDialect) Upsert(keys ...string) string {
+	return "ON DUPLICATE KEY UPDATE"
+}
+
+func (mysqlDialect) Inserted(column string) string {
+	return "VALUES(" + column + ")"
+}
+
+func (mysqlDialect) SkipLocked() string {
+	return "FOR UPDATE SKIP LOCKED"
+}
+
+func (mysqlDialect) ForUpdate() string {
+	return "FOR UPDATE"
+}
+
+func (mysqlDialect) DatetimeType() string {
+	return "DATETIME"
+}
+
+// Builds the MYSQL driver connection string from the "mysql" settings
+//
+// Returns:
+//   - string : Connection string
+//   - error : Set when the TLS configuration or the location cannot be loaded
+func buildDsn() (string, error) {
+	var settings = config.Settings.Mysql
+	var cfg = mysql.NewConfig()
+	cfg.User = settings.Username
+	cfg.Passwd = settings.Password
+	cfg.DBName = settings.Database
+	// Connect through the unix socket when set, over TCP otherwise
+	if settings.Socket != "" {
+		cfg.Net = "unix"
+		cfg.Addr = settings.Socket
+	} else {
+		cfg.Net = "tcp"
+		cfg.Addr = settings.Hostname + ":" + settings.Port
+	}
+	cfg.Timeout = time.Second * time.Duration(settings.Timeout)
+	cfg.ReadTimeout = time.Second * time.Duration(settings.ReadTimeout)
+	cfg.WriteTimeout = time.Second * time.Duration(settings.WriteTimeout)
+	cfg.ParseTime = settings.ParseTime
+	loc, err := time.LoadLocation(settings.Loc)
+	if err != nil {
+		return "", err
+	}
+	cfg.Loc = loc
+	cfg.Params = map[string]string{}
+	for name, value := range settings.Params {
+		cfg.Params[name] = value
+	}
+	if settings.Charset != "" {
+		cfg.Params["charset"] = settings.Charset
+	}
+	// Register TLS configuration
+	if settings.Tls.Enabled {
+		tlsConfig, err := buildTls()
+		if err != nil {
+			return "", err
+		}
+		if err = mysql.RegisterTLSConfig(tlsConfigName, tlsConfig); err != nil {
+			return "", err
+		}
+		cfg.TLSConfig = tlsConfigName
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// Builds the TLS configuration from the "mysql.tls" settings
+//
+// Returns:
+//   - *tls.Config : TLS configuration, verifying the server against the system CAs unless "mysql.tls.ca" is set
+//   - error : Set when the CA or the client certificate cannot be loaded
+func buildTls() (*tls.Config, error) {
+	var settings = config.Settings.Mysql.Tls
+	var tlsConfig = &tls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.SkipVerify,
+	}
+	if tlsConfig.ServerName == "" && config.Settings.Mysql.Socket == "" {
+		tlsConfig.ServerName = config.Settings.Mysql.Hostname
+	}
+	// Trust the given CA
+	if settings.Ca != "" {
+		pem, err := ioutil.ReadFile(settings.Ca)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found on " + settings.Ca)
+		}
+	}
+	// Authenticate with a client certificate
+	if settings.Cert != "" || settings.Key != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.Cert, settings.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	_ "github.com/lib/pq"
+	"net"
+	"net/url"
+	"query-queue-worker/config"
+	"query-queue-worker/types"
+	"strconv"
+	"strings"
+)
+
+// SQL dialect of PostgreSQL servers (9.5 and above for "SKIP LOCKED" and "ON CONFLICT")
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Driver() string {
+	return "postgres"
+}
+
+// Builds the PostgreSQL driver connection URL from the "postgres" settings, connecting through the unix socket directory
+// when set
+func (postgresDialect) Dsn() (string, error) {
+	var settings = config.Settings.Postgres
+	var params = url.Values{}
+	for name, value := range settings.Params {
+		params.Set(name, value)
+	}
+	params.Set("sslmode", settings.SslMode)
+	if settings.SslRootCert != "" {
+		params.Set("sslrootcert", settings.SslRootCert)
+	}
+	if settings.SslCert != "" {
+		params.Set("sslcert", settings.SslCert)
+	}
+	if settings.SslKey != "" {
+		params.Set("sslkey", settings.SslKey)
+	}
+	if settings.Timeout > 0 {
+		params.Set("connect_timeout", strconv.Itoa(settings.Timeout))
+	}
+	var dsn = url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(settings.Username, settings.Password),
+		Path:   "/" + settings.Database,
+	}
+	if settings.Socket != "" {
+		params.Set("host", settings.Socket)
+	} else {
+		dsn.Host = net.JoinHostPort(settings.Hostname, settings.Port)
+	}
+	dsn.RawQuery = params.Encode()
+	return dsn.String(), nil
+}
+
+func (postgresDialect) Pool() types.AppConfigDatabasePool {
+	return config.Settings.Postgres.Pool
+}
+
+func (postgresDialect) Retry() types.AppConfigDatabaseRetry {
+	return config.Settings.Postgres.Retry
+}
+
+// Rewrites "?" placeholders into numbered "$n" placeholders, leaving quoted strings untouched
+func (postgresDialect) Rebind(query string) string {
+	var rebound = strings.Builder{}
+	var count = 0
+	var quoted = false
+	for _, char := range query {
+		switch {
+		case char == '\'':
+			quoted = !quoted
+		case char == '?' && !quoted:
+			count++
+			rebound.WriteString("$" + strconv.Itoa(count))
+			continue
+		}
+		rebound.WriteRune(char)
+	}
+	return rebound.String()
+}
+
+func (postgresDialect) AddInterval(expr string, unit string) string {
+	return "(" + expr + " + CAST(? AS DOUBLE PRECISION) * INTERVAL '1 " + strings.ToLower(unit) + "')"
+}
+
+func (postgresDialect) SecondsSince(expr string) string {
+	return "CAST(EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - " + expr + ")) AS BIGINT)"
+}
+
+func (postgresDialect) IntDiv(dividend string, divisor string) string {
+	return "(" + dividend + " / " + divisor + ")"
+}
+
+func (postgresDialect) Greatest(exprs ...string) string {
+	return "GREATEST(" + strings.Join(exprs, ", ") + ")"
+}
+
+func (postgresDialect) Concat(exprs ...string) string {
+	return "CONCAT(" + strings.Join(exprs, ", ") + ")"
+}
+
+func (postgresDialect) Text(expr string) string {
+	return "CAST(" + expr + " AS TEXT)"
+}
+
+func (postgresDialect) NowPrecise() string {
+	return "CURRENT_TIMESTAMP"
+}
+
+func (postgresDialect) Upsert(keys ...string) string {
+	return "ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET"
+}
+
+func (postgresDialect) Inserted(column string) string {
+	return "EXCLUDED." + column
+}
+
+func (postgresDialect) SkipLocked() string {
+	return "FOR UPDATE SKIP LOCKED"
+}
+
+func (postgresDialect) ForUpdate() string {
+	return "FOR UPDATE"
+}
+
+func (postgresDialect) DatetimeType() string {
+	return "TIMESTAMP(0)"
+}
@@ -0,0 +1,22 @@
+package database
+
+import "testing"
+
+func TestPostgresRebind(t *testing.T) {
+	var tests = []struct {
+		query   string
+		rebound string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"UPDATE t SET a = ? WHERE b = ?", "UPDATE t SET a = $1 WHERE b = $2"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{"SELECT 'it''s ?' FROM t WHERE a = ? AND b = '?'", "SELECT 'it''s ?' FROM t WHERE a = $1 AND b = '?'"},
+		{"SELECT 'a', ?, 'b', ?", "SELECT 'a', $1, 'b', $2"},
+		{"WHERE a IN (?,?,?)", "WHERE a IN ($1,$2,$3)"},
+	}
+	for _, test := range tests {
+		if rebound := (postgresDialect{}).Rebind(test.query); rebound != test.rebound {
+			t.Errorf("Rebind(%q) = %q, want %q", test.query, rebound, test.rebound)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"net/url"
+	"query-queue-worker/config"
+	"query-queue-worker/types"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQL dialect of SQLite databases (pure GO driver, for single host installs and local testing)
+//
+// SQLite has no row locks: claims run in transactions taking the database write lock as soon as they begin, so that
+// workers sharing the database file claim jobs one at a time. Dates are stored as UTC text.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Driver() string {
+	return "sqlite"
+}
+
+// Builds the SQLite driver connection string from the "sqlite" settings
+func (sqliteDialect) Dsn() (string, error) {
+	var settings = config.Settings.Sqlite
+	var params = url.Values{}
+	params.Add("_pragma", "busy_timeout("+strconv.Itoa(settings.BusyTimeout)+")")
+	if settings.JournalMode != "" {
+		params.Add("_pragma", "journal_mode("+settings.JournalMode+")")
+	}
+	// Take the write lock when the claim transaction begins instead of when it first writes
+	params.Set("_txlock", "immediate")
+	return "file:" + settings.Path + "?" + params.Encode(), nil
+}
+
+func (sqliteDialect) Pool() types.AppConfigDatabasePool {
+	return config.Settings.Sqlite.Pool
+}
+
+func (sqliteDialect) Retry() types.AppConfigDatabaseRetry {
+	return config.Settings.Sqlite.Retry
+}
+
+func (sqliteDialect) Rebind(query string) string {
+	return query
+}
+
+// Shifts a date with the date and time functions, microseconds are given as fractional seconds
+func (sqliteDialect) AddInterval(expr string, unit string) string {
+	switch unit {
+	case "MICROSECOND":
+		return "strftime('%Y-%m-%d %H:%M:%f', " + expr + ", (? / 1000000.0) || ' seconds')"
+	case "DAY":
+		return "datetime(" + expr + ", ? || ' days')"
+	}
+	return "datetime(" + expr + ", ? || ' seconds')"
+}
+
+func (sqliteDialect) SecondsSince(expr string) string {
+	return "CAST(strftime('%s', 'now') - strftime('%s', " + expr + ") AS INTEGER)"
+}
+
+func (sqliteDialect) IntDiv(dividend string, divisor string) string {
+	return "(" + dividend + " / " + divisor + ")"
+}
+
+func (sqliteDialect) Greatest(exprs ...string) string {
+	return "MAX(" + strings.Join(exprs, ", ") + ")"
+}
+
+func (sqliteDialect) Concat(exprs ...string) string {
+	return "(" + strings.Join(exprs, " || ") + ")"
+}
+
+func (sqliteDialect) Text(expr string) string {
+	return "CAST(" + expr + " AS TEXT)"
+}
+
+func (sqliteDialect) NowPrecise() string {
+	return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+}
+
+func (sqliteDialect) Upsert(keys ...string) string {
+	return "ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET"
+}
+
+func (sqliteDialect) Inserted(column string) string {
+	return "excluded." + column
+}
+
+func (sqliteDialect) SkipLocked() string {
+	return ""
+}
+
+// Rows need no lock, the transaction already holds the database write lock
+func (sqliteDialect) ForUpdate() string {
+	return ""
+}
+
+func (sqliteDialect) DatetimeType() string {
+	return "TEXT"
+}
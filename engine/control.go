@@ -0,0 +1,195 @@
+package engine
+
+import (
+	"errors"
+	"os/exec"
+	"query-queue-worker/engine/threads"
+	"query-queue-worker/log"
+	"query-queue-worker/types"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Job running on this worker
+type runningJob struct {
+	info      types.EngineJob
+	process   *exec.Cmd
+	cancelled int32
+	aborted   int32
+}
+
+var running = map[string]*runningJob{} // Running jobs by queue and signature (EG: "default/5f2b")
+var runningMu = sync.Mutex{}
+var paused = map[string]bool{} // Paused process types
+var pausedMu = sync.Mutex{}
+var maintenanceRequested int32 = 0 // Set when a maintenance run is requested before its idle time
+var draining int32 = 0             // Set when a graceful drain is requested
+var aborting int32 = 0             // Set once running jobs are killed on stop, jobs started afterwards are killed right away
+
+// Returns the jobs currently running on this worker, sorted by start time
+func GetRunningJobs() []types.EngineJob {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	var jobs = make([]types.EngineJob, 0, len(running))
+	for _, job := range running {
+		var info = job.info
+		info.Elapsed = time.Since(info.StartedAt).Seconds()
+		jobs = append(jobs, info)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.Before(jobs[j].StartedAt)
+	})
+	return jobs
+}
+
+// Stops dispatching new jobs of a process type, running jobs are left to finish
+//
+// Parameters:
+//   - processType string : Reference to the types.EngineThreadsProcessType as string
+//
+// Returns:
+//   - error : Set when the process type is unknown
+func Pause(processType string) error {
+	return setPaused(processType, true)
+}
+
+// Resumes dispatching jobs of a paused process type
+//
+// Parameters:
+//   - processType string : Reference to the types.EngineThreadsProcessType as string
+//
+// Returns:
+//   - error : Set when the process type is unknown
+func Resume(processType string) error {
+	if IsDraining() {
+		return errors.New("worker is draining")
+	}
+	var err = setPaused(processType, false)
+	if err == nil {
+		Wake()
+	}
+	return err
+}
+
+// Returns weather a process type is paused
+//
+// Parameters:
+//   - processType string : Reference to the types.EngineThreadsProcessType as string
+func IsPaused(processType string) bool {
+	pausedMu.Lock()
+	defer pausedMu.Unlock()
+	return paused[processType]
+}
+
+// Returns the paused state of every process type
+func GetPaused() map[string]bool {
+	pausedMu.Lock()
+	defer pausedMu.Unlock()
+	return map[string]bool{
+		threads.Type.Pending:     paused[threads.Type.Pending],
+		threads.Type.Update:      paused[threads.Type.Update],
+		threads.Type.Maintenance: paused[threads.Type.Maintenance],
+	}
+}
+
+// Requests a maintenance run on the next engine cycle, regardless of its idle time, and wakes the engine
+func RequestMaintenance() {
+	atomic.StoreInt32(&maintenanceRequested, 1)
+	Wake()
+}
+
+// Kills the process group of a running job, the job is then recorded as cancelled so that it is not retried
+//
+// Parameters:
+//   - queue (string) : Queue of the running job, empty to look it up on every queue
+//   - signature (string) : Query signature of the running job ("MAINT" for the maintenance job)
+//
+// Returns:
+//   - error : Set when no such job is running on this worker, or when it runs on several queues and none was given
+func Cancel(queue string, signature string) error {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	var job *runningJob
+	for _, candidate := range running {
+		if candidate.info.Signature != signature || (queue != "" && candidate.info.Queue != queue) {
+			continue
+		}
+		if job != nil {
+			return errors.New("job #" + signature + " is running on several queues, a queue is required")
+		}
+		job = candidate
+	}
+	if job == nil {
+		return errors.New("job #" + signature + " is not running on this worker")
+	}
+	log.Writer.Warnf("Cancelling job #%s (pid %d)", signature, job.info.Pid)
+	atomic.StoreInt32(&job.cancelled, 1)
+	return syscall.Kill(-job.process.Process.Pid, syscall.SIGKILL)
+}
+
+// Stops dispatching new jobs of every process type; once stopped, the engine waits for running jobs regardless of the
+// "threads.waitToFinish" setting
+func Drain() {
+	log.Writer.Info("Draining worker, no new jobs will be dispatched...")
+	atomic.StoreInt32(&draining, 1)
+	for _, processType := range []string{threads.Type.Pending, threads.Type.Update, threads.Type.Maintenance} {
+		setPaused(processType, true)
+	}
+}
+
+// Returns weather a graceful drain was requested
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// Sets the paused state of a process type
+func setPaused(processType string, state bool) error {
+	if processType != threads.Type.Pending && processType != threads.Type.Update && processType != threads.Type.Maintenance {
+		return errors.New("unknown process type \"" + processType + "\"")
+	}
+	pausedMu.Lock()
+	paused[processType] = state
+	pausedMu.Unlock()
+	return nil
+}
+
+// Registers a started job so that it can be listed and cancelled
+func registerJob(info types.EngineJob, process *exec.Cmd) *runningJob {
+	var job = &runningJob{info: info, process: process}
+	runningMu.Lock()
+	running[info.Queue+"/"+info.Signature] = job
+	// Jobs started while the engine stops are killed along with the others
+	if atomic.LoadInt32(&aborting) == 1 {
+		abortJob(job)
+	}
+	runningMu.Unlock()
+	return job
+}
+
+// Kills the process group of every running job when the engine stops without waiting for them, so that no job keeps
+// running unattended while its row is recovered and run again by another worker
+func abortJobs() {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	atomic.StoreInt32(&aborting, 1)
+	for _, job := range running {
+		abortJob(job)
+	}
+}
+
+// Kills the process group of a running job stopped with the engine, running jobs must be locked by the caller
+func abortJob(job *runningJob) {
+	log.Writer.Warnf("Stopping job #%s (pid %d)", job.info.Signature, job.info.Pid)
+	atomic.StoreInt32(&job.aborted, 1)
+	syscall.Kill(-job.process.Process.Pid, syscall.SIGKILL)
+}
+
+// Removes a finished job from the running jobs
+func unregisterJob(queue string, signature string) {
+	runningMu.Lock()
+	delete(running, queue+"/"+signature)
+	runningMu.Unlock()
+}
@@ -2,29 +2,69 @@
 package engine
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/creasty/defaults"
+	"os"
 	"os/exec"
 	"query-queue-worker/config"
 	"query-queue-worker/database"
+	"query-queue-worker/engine/groups"
+	"query-queue-worker/engine/history"
+	"query-queue-worker/engine/retry"
+	"query-queue-worker/engine/schedule"
+	"query-queue-worker/engine/store"
 	"query-queue-worker/engine/threads"
 	"query-queue-worker/log"
+	"query-queue-worker/metrics"
 	"query-queue-worker/types"
 	"query-queue-worker/util"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 var engine = types.Engine{}
+var engineMu = sync.Mutex{}    // Guards the engine statistics, updated by job threads and read by the admin API
+var ctx context.Context        // Cancelled when the engine is stopped
+var cancel context.CancelFunc  // Cancels the engine context
+var wake = make(chan bool, 1)  // Receives requests for an immediate engine cycle
+var finished = make(chan bool) // Closed once the engine cycle has stopped
+
+const maxRunErrorLength = 60000 // Maximum length of job output stored in the "runError" TEXT column
 
 // Initializes package
 func Init() {
+	// Refuse to start on an outdated schema
+	if err := database.CheckSchema(); err != nil {
+		util.Die("Error: %v\n", err.Error())
+	}
+	// Refuse to start on queue tables missing columns, migrations only upgrade the default queue table
+	for _, queue := range store.Queues {
+		if err := queue.CheckTable(); err != nil {
+			util.Die("Error: %v\n", err.Error())
+		}
+	}
 	// Initialize engine data
 	defaults.Set(&engine)
+	// Identify this worker (used to flag claimed jobs)
+	engine.Id = config.Settings.Worker.Id
+	if engine.Id == "" {
+		hostname, _ := os.Hostname()
+		engine.Id = hostname + ":" + strconv.Itoa(os.Getpid())
+	}
+	// Initialize schedule timezone
+	schedule.Init()
+	// Initialize concurrency groups
+	groups.Init()
 	// Initialize threads
 	threads.Init()
+	// Restore persisted statistics, once the process types are known
+	loadStats()
 }
 
 // Starts worker thread
@@ -32,57 +72,140 @@ func Start() {
 	// Starting engine
 	log.Writer.Info("Starting worker engine...")
 	// Start
-	engine.Status = "started"
+	setStatus("started")
+	ctx, cancel = context.WithCancel(context.Background())
+	finished = make(chan bool)
 	// Start engine cycle
 	go func() {
-		for engine.Status == "started" {
-			// Re-check only after idle timeout
-			if engine.Cycles == -1 || engine.Cycles >= config.Settings.Worker.Idle {
-				// Reset elapsed so that we count another idle timeout
-				engine.Cycles = 0
-				// Check for availability to allocate new jobs
-				if threads.GetAllocationCount() > 0 {
-					// Process new jobs lookup and allocation
-					pendingCount, updateCount, maintenanceCount := processLookup()
-					// Notify
-					log.Writer.Infof("Lookup for pending jobs: Pending(%d) ; Update(%d) ; Maintenance(%d);", pendingCount, updateCount, maintenanceCount)
-					// Process pending queries
-					if pendingCount > 0 {
-						processPending()
-					}
-					// Process update on current queries
-					if updateCount > 0 {
-						processUpdate()
-					}
-					// Process maintenance
-					if maintenanceCount > 0 {
-						processMaintenance()
-					}
+		for {
+			var sleep = time.Second * time.Duration(config.Current().Worker.Idle)
+			var wakeup = wake
+			// Skip the cycle and back off while the database is unreachable, freed threads do not wake a degraded engine
+			if err := runCycle(); err != nil {
+				sleep = cycleFailed(err)
+				wakeup = nil
+			} else {
+				cycleSucceeded()
+			}
+			// Sleep until idle timeout, a freed thread or a stop request
+			var timer = time.NewTimer(sleep)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				// Kill running jobs that are not waited for, their rows are returned to the queue
+				if !config.Current().Threads.WaitToFinish && !IsDraining() {
+					abortJobs()
 				}
+				// Wait for threads to complete, killed jobs included so that their rows are released
+				threads.Wait()
+				// Persist statistics of the last jobs
+				flushStats(true)
+				close(finished)
+				return
+			case <-wakeup:
+				timer.Stop()
+			case <-timer.C:
 			}
-			// Increment elapsed and sleep for one second
-			engine.Cycles++
-			time.Sleep(time.Second)
 		}
-		// Wait for threads to complete
-		threads.Wait()
 	}()
 }
 
-// Stops worker thread
+// Stops worker thread, blocking until the engine cycle and its running threads have finished. Running jobs are killed and
+// returned to the queue unless "threads.waitToFinish" is set or the worker is draining
 func Stop() {
 	// Notify
 	log.Writer.Info("Stopping worker engine...")
 	// Set worker status
-	engine.Status = "stopped"
+	setStatus("stopped")
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-finished
+}
+
+// Requests an immediate engine cycle (EG: when a thread is freed), requests made while a cycle is due are merged
+func Wake() {
+	select {
+	case wake <- true:
+	default:
+	}
+}
+
+// Runs one engine cycle: recovers and re-schedules jobs, then looks up and dispatches new jobs
+//
+// Returns:
+//   - error : Set when the queue table cannot be reached, the rest of the cycle is skipped
+func runCycle() error {
+	engineMu.Lock()
+	engine.Cycles++
+	engineMu.Unlock()
+	// Persist statistics periodically
+	flushStats(false)
+	// Refresh quarantined jobs statistics
+	loadQuarantine()
+	// Recover jobs left behind by crashed workers
+	if err := processRecovery(); err != nil {
+		return err
+	}
+	// Re-schedule failed jobs that still have attempts left
+	if err := processRetries(); err != nil {
+		return err
+	}
+	// Check for availability to allocate new jobs
+	if threads.GetAllocationCount() <= 0 {
+		return nil
+	}
+	// Process new jobs lookup and allocation
+	pendingCount, updateCount, maintenanceCount, err := processLookup()
+	if err != nil {
+		return err
+	}
+	// Notify
+	log.Writer.Infof("Lookup for pending jobs: Pending(%d) ; Update(%d) ; Maintenance(%d);", pendingCount, updateCount, maintenanceCount)
+	// Process pending queries
+	if pendingCount > 0 {
+		if err = processPending(); err != nil {
+			return err
+		}
+	}
+	// Process update on current queries
+	if updateCount > 0 {
+		if err = processUpdate(); err != nil {
+			return err
+		}
+	}
+	// Process maintenance
+	if maintenanceCount > 0 {
+		processMaintenance()
+	}
+	return nil
 }
 
 // Gets engine data
 //
 // Return:
-//   - types.Engine : Engine struct with worker statistics data
+//   - types.Engine : Copy of the engine struct with worker statistics data
 func GetData() types.Engine {
-	return engine
+	engineMu.Lock()
+	defer engineMu.Unlock()
+	var data = engine
+	data.Processes.Pending.Count.Blacklist = append([]string(nil), engine.Processes.Pending.Count.Blacklist...)
+	data.Processes.Update.Count.Blacklist = append([]string(nil), engine.Processes.Update.Count.Blacklist...)
+	data.Processes.Pending.Queries = copyQueryStats(engine.Processes.Pending.Queries)
+	data.Processes.Update.Queries = copyQueryStats(engine.Processes.Update.Queries)
+	data.Processes.Maintenance.Queries = copyQueryStats(engine.Processes.Maintenance.Queries)
+	return data
+}
+
+// Sets the engine status
+//
+// Parameters:
+//   - status (string) : Engine status (EG: "started")
+func setStatus(status string) {
+	engineMu.Lock()
+	engine.Status = status
+	engineMu.Unlock()
 }
 
 // Processes database lookup for pending jobs (pending, update, maintenance) and tries to allocate threads based on the number of jobs required
@@ -91,122 +214,221 @@ func GetData() types.Engine {
 //   - totalPending (int) : Total number of jobs of "pending" type
 //   - totalUpdate (int) : Total number of jobs of "update" type
 //   - totalMaintenance (int) : Total number of jobs of "maintenance" type
-func processLookup() (totalPending int, totalUpdate int, totalMaintenance int) {
-	// Check for pending and update jobs count
-	var query = `
-		SELECT
-			COUNT(IF(runStatus = 'pending',1,NULL)) AS TotalPending,
-			COUNT(IF(runStatus = 'completed',1,NULL)) AS TotalUpdate
-		FROM tblCRQueryQueue
-		WHERE
-			(runStatus = 'pending') OR
-			(runStatus = 'completed' AND runRepeat IS NOT NULL AND (runNext IS NULL OR runNext <= NOW()))`
-	result := database.Con.QueryRow(query)
-	// Get allocation counts
-	var err = result.Scan(&totalPending, &totalUpdate)
-	if err != nil {
-		util.Die("Error: cannot select allocation from CrQueryQueue table \n %v\n", err.Error())
+//   - err (error) : Set when the queue table cannot be read
+func processLookup() (totalPending int, totalUpdate int, totalMaintenance int, err error) {
+	// Check for pending and update jobs count and their highest priority, across every queue
+	var startedAt = time.Now()
+	var pendingPriority, updatePriority int
+	for i, queue := range store.Queues {
+		pending, update, queuePendingPriority, queueUpdatePriority, err := queue.Lookup()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		totalPending += pending
+		totalUpdate += update
+		if i == 0 || queuePendingPriority > pendingPriority {
+			pendingPriority = queuePendingPriority
+		}
+		if i == 0 || queueUpdatePriority > updatePriority {
+			updatePriority = queueUpdatePriority
+		}
+	}
+	metrics.LookupFinished(time.Since(startedAt), totalPending, totalUpdate)
+	// Paused process types are not allocated threads
+	if IsPaused(threads.Type.Pending) {
+		totalPending = 0
+	}
+	if IsPaused(threads.Type.Update) {
+		totalUpdate = 0
 	}
 	// Check for next run on maintenance job
 	totalMaintenance = 0
+	engineMu.Lock()
 	var lastRun = engine.Processes.Maintenance.LastRun.Unix()
-	var idle = time.Duration(config.Settings.Worker.Processes.Maintenance.Idle)
+	engineMu.Unlock()
+	var idle = time.Duration(config.Current().Worker.Processes.Maintenance.Idle)
 	var nextRun = time.Unix(lastRun, 0).Add(time.Second * idle)
-	if nextRun.Before(time.Now()) {
+	var requested = atomic.SwapInt32(&maintenanceRequested, 0) == 1
+	if nextRun.Before(time.Now()) || requested {
 		totalMaintenance = 1
 	}
+	if IsPaused(threads.Type.Maintenance) {
+		totalMaintenance = 0
+	}
 	// Allocate
-	threads.Allocate(totalPending, totalUpdate, totalMaintenance)
+	threads.Allocate(totalPending, totalUpdate, totalMaintenance, pendingPriority, updatePriority)
 	return
 }
 
 // Lookup for queries with pending status db and starts new threads based on jobs that it finds
-func processPending() {
+//
+// Returns:
+//   - error : Set when the jobs cannot be claimed
+func processPending() error {
 	// Get current available threads
 	var availableThreads = threads.GetAvailableCount(threads.Type.Pending)
 	if availableThreads <= 0 {
 		log.Writer.Info("Skipping pending process, no threads available")
-		return
+		return nil
 	}
-	// Check for pending jobs with no more than available threads
-	var query = `
-		SELECT
-			querySignature,
-			queryName
-		FROM tblCRQueryQueue 
-		WHERE 
-		    runStatus = 'pending'
-		ORDER BY 
-		    runFirst IS NULL DESC,
-		    pkQueryQueueID ASC
-		LIMIT ` + strconv.Itoa(availableThreads)
-	results, err := database.Con.Query(query)
-	if err != nil {
-		util.Die("Error: cannot select pending tasks from CrQueryQueue table \n %v\n", err.Error())
-	}
-	// Create new workers for each query
-	var counter = 0
-	for results.Next() {
-		var row = new(types.TblCRQueryQueue)
-		// For each row, scan the result into our tag composite object
-		err = results.Scan(&row.QuerySignature, &row.QueryName)
+	// Claim pending jobs with no more than available threads, queues take turns on being claimed first
+	var claimed = 0
+	for _, queue := range queueTurn() {
+		if claimed >= availableThreads {
+			break
+		}
+		jobs, err := queue.ClaimPending(engine.Id, availableThreads-claimed)
 		if err != nil {
-			util.Die("Error: cannot scan pending tasks from CrQueryQueue table \n %v\n", err.Error())
+			return err
+		}
+		// Create new workers for each claimed query
+		for _, row := range jobs {
+			var thread = threads.Add(threads.Type.Pending)
+			go processJob(queue, row, threads.Type.Pending, thread, row.QuerySignature)
 		}
-		// Process query
-		go processJob(row.QuerySignature, row.QueryName, threads.Type.Pending, row.QuerySignature)
-		counter++
+		claimed += len(jobs)
 	}
 	// Report if no queries are pending
-	if counter <= 0 {
+	if claimed <= 0 {
 		log.Writer.Info("No pending queries to be processed...")
 	}
+	return nil
 }
 
 // Lookup for queries that require update from db and starts new threads based on jobs that it finds
-func processUpdate() {
+//
+// Returns:
+//   - error : Set when the jobs cannot be claimed
+func processUpdate() error {
 	// Get current available threads
 	var availableThreads = threads.GetAvailableCount(threads.Type.Update)
 	if availableThreads <= 0 {
 		log.Writer.Info("Skipping update process, no threads available")
-		return
+		return nil
 	}
-	// Check for pending jobs with no more than available threads
-	var query = `
-		SELECT
-			querySignature,
-			queryName
-		FROM tblCRQueryQueue 
-		WHERE 
-		    runStatus = 'completed' AND
-		    runRepeat IS NOT NULL AND 
-		    (runNext IS NULL OR runNext <= NOW())
-		ORDER BY 
-		    runFirst IS NULL DESC,
-		    runLast IS NULL DESC,
-		    pkQueryQueueID ASC
-		LIMIT ` + strconv.Itoa(availableThreads)
-	results, err := database.Con.Query(query)
-	if err != nil {
-		util.Die("Error: cannot select update tasks from CrQueryQueue table \n %v\n", err.Error())
-	}
-	// Create new workers for each query
-	var counter = 0
-	for results.Next() {
-		var row = new(types.TblCRQueryQueue)
-		// For each row, scan the result into our tag composite object
-		err = results.Scan(&row.QuerySignature, &row.QueryName)
+	// Claim update jobs with no more than available threads, queues take turns on being claimed first
+	var claimed = 0
+	for _, queue := range queueTurn() {
+		if claimed >= availableThreads {
+			break
+		}
+		jobs, err := queue.ClaimUpdate(engine.Id, availableThreads-claimed)
 		if err != nil {
-			util.Die("Error: cannot scan update tasks from CrQueryQueue table \n %v\n", err.Error())
+			return err
+		}
+		// Create new workers for each claimed query
+		for _, row := range jobs {
+			var thread = threads.Add(threads.Type.Update)
+			go processJob(queue, row, threads.Type.Update, thread, row.QuerySignature)
 		}
-		// Process query
-		go processJob(row.QuerySignature, row.QueryName, threads.Type.Update, row.QuerySignature)
-		counter++
+		claimed += len(jobs)
 	}
 	// Report if no queries are pending
-	if counter <= 0 {
+	if claimed <= 0 {
 		log.Writer.Info("No queries to be updated...")
 	}
+	return nil
+}
+
+// Returns jobs stuck in "processing" with an expired lease (EG: claimed by a crashed worker) back to "pending"
+//
+// Jobs that were already recovered "worker.lease.maxRecoveries" times are marked as "failed" instead
+//
+// Returns:
+//   - error : Set when the queue table cannot be updated
+func processRecovery() error {
+	for _, queue := range store.Queues {
+		recoveredCount, failedCount, err := queue.Recover(config.Settings.Worker.Lease.MaxRecoveries)
+		if err != nil {
+			return err
+		}
+		// Notify
+		if failedCount > 0 || recoveredCount > 0 {
+			log.Writer.Warnf("Expired leases on queue %s: Recovered(%d) ; Failed(%d);", queue.Name(), recoveredCount, failedCount)
+		}
+	}
+	return nil
+}
+
+// Moves failed jobs back to "pending" with a backoff delay on "runNext" until their retry policy attempts are exhausted
+//
+// Jobs that exhausted their attempts stay "failed" (dead letters) until they are reset by hand, as do jobs with an invalid
+// "runRepeat" definition
+//
+// Returns:
+//   - error : Set when the failed jobs cannot be read
+func processRetries() error {
+	var maxAttempts = retry.MaxAttempts()
+	if maxAttempts <= 0 {
+		return nil
+	}
+	for _, queue := range store.Queues {
+		jobs, err := queue.Retryable(maxAttempts)
+		if err != nil {
+			return err
+		}
+		// Re-schedule each job according to its own policy
+		for _, row := range jobs {
+			var policy = retry.Policy(row.QueryName)
+			if row.Attempts >= policy.MaxAttempts {
+				continue
+			}
+			// Rejected schedules would fail again, they are left for the schedule to be fixed
+			if row.RunRepeat != "" && schedule.Validate(row.RunRepeat) != nil {
+				continue
+			}
+			var delay = retry.Delay(policy, row.Attempts)
+			if err = queue.Retry(row, delay); err != nil {
+				metrics.DatabaseError("retry")
+				log.Writer.Errorf("Cannot re-schedule failed job #%s: %v", jobLabel(queue, row.QuerySignature), err.Error())
+				continue
+			}
+			log.Writer.Infof("Failed job #%s re-scheduled in %v (attempt %d of %d)", jobLabel(queue, row.QuerySignature), delay.Round(time.Second), row.Attempts+1, policy.MaxAttempts)
+		}
+	}
+	return nil
+}
+
+// Logs a warning for each repeating job with a "runRepeat" definition the worker cannot parse
+//
+// Rows are left untouched, tables upgraded from the legacy worker may hold schedules that their commands still manage
+func validateSchedules() {
+	for _, queue := range store.Queues {
+		jobs, err := queue.Repeating()
+		if err != nil {
+			metrics.DatabaseError("validate_schedules")
+			log.Writer.Errorf("Cannot read repeating jobs of queue %s: %v", queue.Name(), err.Error())
+			continue
+		}
+		// Report invalid schedules
+		for _, row := range jobs {
+			if err = schedule.Validate(row.RunRepeat); err != nil {
+				log.Writer.Warnf("Job #%s has an invalid runRepeat, its runNext is not computed by the worker: %v", jobLabel(queue, row.QuerySignature), err.Error())
+			}
+		}
+	}
+}
+
+// Refreshes the lease of a claimed job until the done channel is closed
+//
+// Parameters:
+//   - queue (store.Store) : Queue of the claimed job
+//   - job (types.TblCRQueryQueue) : The claimed row
+//   - done (chan bool) : Channel closed once the job process has finished
+func heartbeat(queue store.Store, job types.TblCRQueryQueue, done chan bool) {
+	var ticker = time.NewTicker(time.Second * time.Duration(config.Settings.Worker.Lease.Heartbeat))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := queue.Heartbeat(job, engine.Id); err != nil {
+				metrics.DatabaseError("heartbeat")
+				log.Writer.Warnf("Cannot refresh lease of job #%s: %v", jobLabel(queue, job.QuerySignature), err.Error())
+			}
+		}
+	}
 }
 
 // Processes maintenance job type
@@ -217,73 +439,380 @@ func processMaintenance() {
 		log.Writer.Info("Skipping maintenance process, no threads available")
 		return
 	}
+	// Report repeating jobs with schedules the worker cannot understand
+	validateSchedules()
+	// Apply run history retention
+	history.Purge()
 	// Process maintenance
-	go processJob("MAINT", "System Maintenance", threads.Type.Maintenance)
+	var job = types.TblCRQueryQueue{QuerySignature: "MAINT", QueryName: "System Maintenance"}
+	var thread = threads.Add(threads.Type.Maintenance)
+	go processJob(store.Queue, job, threads.Type.Maintenance, thread)
 }
 
-// Creates a new threaded process for running a job
+// Creates a new threaded process for running a job, its thread must be added by the caller before the go routine starts
 // Returns:
-//   - jobId (string) : The unique identifier of this job, should be set to the query signature apart from the maintenance job type
-//   - jobName (string) : The job name, usually column "name" of the query to be processed
+//   - queue (store.Store) : Queue of the job, the default queue for the maintenance job
+//   - job (types.TblCRQueryQueue) : The claimed row to process, its signature is used as the job unique identifier
 //   - threadType (string) : String representation of the threadType to run (pending, update, maintenance)
+//   - thread (int) : Thread slot returned by threads.Add when the caller added the thread
 //   - cmdArgs (...interface{}) : Arguments passed to the shell cmd command defined in the Settings config
-func processJob(jobId string, jobName string, threadType string, cmdArgs ...string) {
-	// Initialize new thread
-	threads.Add(threadType)
-	var threadId = strconv.Itoa(threads.GetUsedCount(threadType))
-	// Get command based on thread type
+func processJob(queue store.Store, job types.TblCRQueryQueue, threadType string, thread int, cmdArgs ...string) {
+	var jobId = job.QuerySignature
+	var jobName = job.QueryName
+	var timeout = job.RunTimeout
+	var threadId = strconv.Itoa(thread)
+	// Get command and timeout based on thread type, queues may override the job commands
 	var cmd = "echo 1"
+	var typeTimeout = 0
+	var commands = config.Queues()[queue.Name()].Commands
+	var settings = config.Current()
 	switch threadType {
 	case threads.Type.Pending:
-		cmd = config.Settings.Worker.Commands.Single
+		cmd = settings.Worker.Commands.Single
+		if commands.Single != "" {
+			cmd = commands.Single
+		}
+		typeTimeout = settings.Worker.Processes.Pending.Timeout
 		break
 	case threads.Type.Update:
-		cmd = config.Settings.Worker.Commands.Update
+		cmd = settings.Worker.Commands.Update
+		if commands.Update != "" {
+			cmd = commands.Update
+		}
+		typeTimeout = settings.Worker.Processes.Update.Timeout
 		break
 	case threads.Type.Maintenance:
-		cmd = config.Settings.Worker.Commands.Maintenance
+		cmd = settings.Worker.Commands.Maintenance
+		typeTimeout = settings.Worker.Processes.Maintenance.Timeout
 		break
 	}
-	// Build command args
-	var command = cmd
-	for _, arg := range cmdArgs {
-		command = fmt.Sprintf(command, arg)
+	// Job timeout overrides process type timeout, which overrides the global timeout
+	if timeout <= 0 {
+		timeout = typeTimeout
 	}
+	if timeout <= 0 {
+		timeout = settings.Worker.Timeout
+	}
+	// Build command args, commands are always formatted so that "%%" stands for a literal "%" even without placeholders
+	var values = make([]interface{}, len(cmdArgs))
+	for i, arg := range cmdArgs {
+		values[i] = arg
+	}
+	var command = fmt.Sprintf(cmd, values...)
 	args := strings.Split(command, " ")
 	// Build identifier
 	var jobIdentifier = threadType + " | Thread" + threadId + " : "
 	// Run command
-	log.Writer.Info(jobIdentifier + "Running new job with ID #" + jobId + ": " + jobName)
-	exec := exec.Command(config.Settings.Worker.Executable, args...)
+	log.Writer.Info(jobIdentifier + "Running new job with ID #" + jobLabel(queue, jobId) + ": " + jobName)
+	metrics.JobStarted(threadType, jobName)
+	process := exec.Command(settings.Worker.Executable, args...)
 	// Prevent CMD from stopping execution when syscall.SIGINT is issued
-	exec.SysProcAttr = &syscall.SysProcAttr{
+	process.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
-	out, err := exec.CombinedOutput()
-	var output = string(out)
-	if err != nil {
-		util.Die(jobIdentifier+"Error: cannot execute command \n %s\n", output)
+	// Keep the lease of claimed jobs alive while the command is running
+	var done = make(chan bool)
+	if threadType != threads.Type.Maintenance {
+		go heartbeat(queue, job, done)
 	}
+	// Run command, killing its whole process group if it exceeds the timeout
+	var out bytes.Buffer
+	var timedOut int32 = 0
+	var startedAt = time.Now()
+	process.Stdout = &out
+	process.Stderr = &out
+	err := process.Start()
+	var registered *runningJob
+	if err == nil {
+		registered = registerJob(types.EngineJob{
+			Queue:     queue.Name(),
+			Signature: jobId,
+			Name:      jobName,
+			Type:      threadType,
+			Thread:    threadId,
+			Pid:       process.Process.Pid,
+			StartedAt: startedAt,
+		}, process)
+		var timer *time.Timer
+		if timeout > 0 {
+			timer = time.AfterFunc(time.Second*time.Duration(timeout), func() {
+				atomic.StoreInt32(&timedOut, 1)
+				syscall.Kill(-process.Process.Pid, syscall.SIGKILL)
+			})
+		}
+		err = process.Wait()
+		if timer != nil {
+			timer.Stop()
+		}
+		unregisterJob(queue.Name(), jobId)
+	}
+	close(done)
+	var cancelled = registered != nil && atomic.LoadInt32(&registered.cancelled) == 1
+	var aborted = registered != nil && atomic.LoadInt32(&registered.aborted) == 1
+	var duration = time.Since(startedAt)
+	var output = out.String()
 	var lines = strings.Split(output, "\n")
 	for _, line := range lines {
 		if line != "" {
 			log.Writer.Info(jobIdentifier + line)
 		}
 	}
-	// Finalize thread count
-	threads.Remove(threadType)
+	// Handle failed jobs without stopping the engine
+	var successful = err == nil
+	var runError = ""
+	if !successful {
+		runError = describeFailure(err, atomic.LoadInt32(&timedOut) == 1, cancelled, aborted, timeout)
+		log.Writer.Error(jobIdentifier + "Error: " + runError)
+		if output != "" {
+			runError += "\n" + output
+		}
+	}
+	// Record job outcome on the queue table, cancelled jobs are kept from being processed or retried again while jobs
+	// stopped with the engine are returned to the queue
+	if threadType != threads.Type.Maintenance {
+		if aborted {
+			requeue(queue, job, threadType)
+		} else if cancelled {
+			markCancelled(queue, job, runError)
+		} else if settings.Worker.Managed {
+			markFinished(queue, job, successful, runError, duration)
+		} else if !successful {
+			markFailed(queue, job, runError)
+		} else {
+			markCompleted(queue, job)
+		}
+	}
+	// Count consecutive failures, cancelled and stopped jobs are left out as they were stopped on request
+	if threadType != threads.Type.Maintenance && !cancelled && !aborted {
+		recordQuarantine(queue, job, threadType, successful, runError)
+	}
+	// Record execution on the run history
+	var runStatus = "completed"
+	if cancelled {
+		runStatus = "cancelled"
+	} else if aborted {
+		runStatus = "stopped"
+	} else if atomic.LoadInt32(&timedOut) == 1 {
+		runStatus = "timed out"
+	} else if !successful {
+		runStatus = "failed"
+	}
+	history.Record(types.TblCRQueryQueueRun{
+		QueueName:      queue.Name(),
+		QuerySignature: jobId,
+		QueryName:      jobName,
+		ProcessType:    threadType,
+		WorkerId:       engine.Id,
+		ThreadId:       thread,
+		RunStatus:      runStatus,
+		ExitCode:       exitCode(err),
+		Output:         output,
+	}, duration)
+	// Finalize thread count and look for new jobs on the freed thread
+	threads.Remove(threadType, thread)
+	Wake()
 	// Add to Engine stats
-	addStats(jobId, threadType, err != nil)
+	addStats(jobId, threadType, successful, atomic.LoadInt32(&timedOut) == 1)
+	addQueryStats(threadType, jobName, successful, atomic.LoadInt32(&timedOut) == 1, runError)
+	queueStats(threadType, jobName, successful, atomic.LoadInt32(&timedOut) == 1, runError)
+	metrics.JobFinished(threadType, jobName, successful, atomic.LoadInt32(&timedOut) == 1, duration)
 	// Notify
 	log.Writer.Info(jobIdentifier + "Finalized job")
 }
 
+// Returns the exit code of a job command
+//
+// Parameters:
+//   - err (error) : Error returned when running the command
+//
+// Returns:
+//   - int : Exit code, -1 when the command could not start or was killed by a signal
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// Builds a short description of why a job command failed
+//
+// Parameters:
+//   - err (error) : Error returned when running the command
+//   - timedOut (bool) : Weather the command was killed for exceeding its timeout
+//   - cancelled (bool) : Weather the command was killed by a cancel request
+//   - aborted (bool) : Weather the command was killed as the engine stopped
+//   - timeout (int) : Timeout in seconds applied to the command
+//
+// Returns:
+//   - string : Failure description, including the exit code when available
+func describeFailure(err error, timedOut bool, cancelled bool, aborted bool, timeout int) string {
+	if cancelled {
+		return "job cancelled, process group killed"
+	}
+	if aborted {
+		return "job stopped with the worker, process group killed"
+	}
+	if timedOut {
+		return fmt.Sprintf("job timed out after %d seconds, process group killed", timeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return fmt.Sprintf("command exited with code %d", exitErr.ExitCode())
+	}
+	return fmt.Sprintf("cannot execute command: %v", err.Error())
+}
+
+// Flags a claimed job as failed and releases its claim
+//
+// Parameters:
+//   - queue (store.Store) : Queue of the claimed job
+//   - job (types.TblCRQueryQueue) : The claimed row that was processed
+//   - runError (string) : Failure description stored in the "runError" column
+func markFailed(queue store.Store, job types.TblCRQueryQueue, runError string) {
+	if err := queue.MarkFailed(job, engine.Id, truncateRunError(runError)); err != nil {
+		metrics.DatabaseError("mark_failed")
+		log.Writer.Errorf("Cannot flag job #%s as failed: %v", jobLabel(queue, job.QuerySignature), err.Error())
+	}
+}
+
+// Flags a claimed job cancelled on request as cancelled and releases its claim
+//
+// Parameters:
+//   - queue (store.Store) : Queue of the claimed job
+//   - job (types.TblCRQueryQueue) : The claimed row that was processed
+//   - runError (string) : Failure description stored in the "runError" column
+func markCancelled(queue store.Store, job types.TblCRQueryQueue, runError string) {
+	if err := queue.MarkCancelled(job, engine.Id, truncateRunError(runError)); err != nil {
+		metrics.DatabaseError("mark_cancelled")
+		log.Writer.Errorf("Cannot flag job #%s as cancelled: %v", jobLabel(queue, job.QuerySignature), err.Error())
+	}
+}
+
+// Returns a claimed job killed as the engine stopped to the status it was claimed from and releases its claim, so that it
+// is run again without waiting for its lease to expire
+//
+// Parameters:
+//   - queue (store.Store) : Queue of the claimed job
+//   - job (types.TblCRQueryQueue) : The claimed row that was processed
+//   - threadType (string) : String representation of the threadType that processed the row (pending, update)
+func requeue(queue store.Store, job types.TblCRQueryQueue, threadType string) {
+	var status = "pending"
+	if threadType == threads.Type.Update {
+		status = "completed"
+	}
+	if err := queue.Requeue(job, engine.Id, status); err != nil {
+		metrics.DatabaseError("requeue")
+		log.Writer.Errorf("Cannot return job #%s to the queue: %v", jobLabel(queue, job.QuerySignature), err.Error())
+	}
+}
+
+// Records the outcome of a claimed job when the worker manages the job lifecycle ("worker.managed" setting)
+//
+// Sets the final status, "runTime", "runLast", "runError" and, for successful repeating jobs, "runNext" computed from "runRepeat"
+//
+// Parameters:
+//   - queue (store.Store) : Queue of the claimed job
+//   - job (types.TblCRQueryQueue) : The claimed row that was processed
+//   - successful (bool) : Weather the job command succeeded
+//   - runError (string) : Failure description stored in the "runError" column
+//   - duration (time.Duration) : Wall time taken by the job command
+func markFinished(queue store.Store, job types.TblCRQueryQueue, successful bool, runError string, duration time.Duration) {
+	var status = "failed"
+	var runNext *time.Duration
+	if successful {
+		status = "completed"
+		// Schedule next run of repeating jobs (stored as an offset to the database clock)
+		if job.RunRepeat != "" {
+			var now = time.Now()
+			next, err := schedule.Next(job.RunRepeat, now)
+			if err != nil {
+				status = "failed"
+				runError = "Cannot schedule next run: " + err.Error()
+				log.Writer.Errorf("Cannot schedule next run of job #%s: %v", jobLabel(queue, job.QuerySignature), err.Error())
+			} else {
+				var offset = next.Sub(now)
+				runNext = &offset
+			}
+		}
+	}
+	err := queue.MarkFinished(job, engine.Id, status, truncateRunError(runError), duration, runNext)
+	if err != nil {
+		metrics.DatabaseError("mark_finished")
+		log.Writer.Errorf("Cannot record outcome of job #%s: %v", jobLabel(queue, job.QuerySignature), err.Error())
+	}
+}
+
+// Releases the claim of a job completed by its own command (when "worker.managed" is disabled), resets its retry attempts
+// and, for repeating jobs, sets "runNext". Rows the command left on "processing" are flagged as "completed", repeating
+// jobs whose next run cannot be scheduled keep the "runNext" set by their command
+//
+// Parameters:
+//   - queue (store.Store) : Queue of the claimed job
+//   - job (types.TblCRQueryQueue) : The claimed row that was processed
+func markCompleted(queue store.Store, job types.TblCRQueryQueue) {
+	var runNext *time.Duration
+	if job.RunRepeat != "" {
+		var now = time.Now()
+		next, err := schedule.Next(job.RunRepeat, now)
+		if err != nil {
+			log.Writer.Warnf("Cannot schedule next run of job #%s, its runNext is left as is: %v", jobLabel(queue, job.QuerySignature), err.Error())
+		} else {
+			var offset = next.Sub(now)
+			runNext = &offset
+		}
+	}
+	if err := queue.MarkCompleted(job, engine.Id, runNext); err != nil {
+		metrics.DatabaseError("mark_completed")
+		log.Writer.Errorf("Cannot record completion of job #%s: %v", jobLabel(queue, job.QuerySignature), err.Error())
+	}
+}
+
+// Returns the queues in the order they are claimed on this cycle, rotating the first queue on every cycle so that a busy
+// queue does not keep the threads from the others
+func queueTurn() []store.Store {
+	engineMu.Lock()
+	var offset = engine.Cycles % len(store.Queues)
+	engineMu.Unlock()
+	return append(append([]store.Store{}, store.Queues[offset:]...), store.Queues[:offset]...)
+}
+
+// Returns the label of a job on logs, its signature prefixed with its queue name when several queues are processed
+//
+// Parameters:
+//   - queue (store.Store) : Queue of the job
+//   - signature (string) : Query signature of the job
+//
+// Returns:
+//   - string : Job label (EG: "reports/5f2b")
+func jobLabel(queue store.Store, signature string) string {
+	if len(store.Queues) <= 1 {
+		return signature
+	}
+	return queue.Name() + "/" + signature
+}
+
+// Truncates a job output to the last maxRunErrorLength bytes so that it fits the "runError" column
+//
+// Parameters:
+//   - runError (string) : Failure description
+//
+// Returns:
+//   - string : Truncated failure description
+func truncateRunError(runError string) string {
+	return util.Tail(runError, maxRunErrorLength)
+}
+
 // Adds statistical data relevant to a job (pending, update, maintenance) into the engine statistics struct
 // Returns:
 //   - identifier (string) : The unique identifier of this job, should be set to the query signature apart from the maintenance job type
 //   - threadType (string) : String representation of the threadType to run (pending, update, maintenance)
 //   - successful (bool) : Weather this job was or not processed successfully
-func addStats(identifier string, threadType string, successful bool) {
+//   - timedOut (bool) : Weather this job was killed for exceeding its timeout
+func addStats(identifier string, threadType string, successful bool, timedOut bool) {
+	engineMu.Lock()
+	defer engineMu.Unlock()
 	switch threadType {
 	case threads.Type.Pending:
 		engine.Processes.Pending.Count.Total++
@@ -292,8 +821,9 @@ func addStats(identifier string, threadType string, successful bool) {
 			engine.Processes.Pending.Count.Successful++
 		} else {
 			engine.Processes.Pending.Count.Failed++
-			// TODO Maybe create a statistical table with this info at some point
-			//engine.Processes.Pending.Count.Blacklist = append(engine.Processes.Pending.Count.Blacklist, identifier)
+			if timedOut {
+				engine.Processes.Pending.Count.TimedOut++
+			}
 		}
 		break
 	case threads.Type.Update:
@@ -303,8 +833,9 @@ func addStats(identifier string, threadType string, successful bool) {
 			engine.Processes.Update.Count.Successful++
 		} else {
 			engine.Processes.Update.Count.Failed++
-			// TODO Maybe create a statistical table with this info at some point
-			//engine.Processes.Update.Count.Blacklist = append(engine.Processes.Update.Count.Blacklist, identifier)
+			if timedOut {
+				engine.Processes.Update.Count.TimedOut++
+			}
 		}
 		break
 	case threads.Type.Maintenance:
@@ -314,6 +845,9 @@ func addStats(identifier string, threadType string, successful bool) {
 			engine.Processes.Maintenance.Count.Successful++
 		} else {
 			engine.Processes.Maintenance.Count.Failed++
+			if timedOut {
+				engine.Processes.Maintenance.Count.TimedOut++
+			}
 		}
 		break
 	}
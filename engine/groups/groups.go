@@ -0,0 +1,130 @@
+// Package groups resolves the concurrency groups of jobs, limiting how many jobs of the same group may run at once
+//
+// Groups are set on "worker.concurrency.groups", each with a limit and a list of query names. Query names accept the "*"
+// (any characters) and "?" (single character) wildcards. A job may belong to several groups, in which case it is only
+// dispatched when all of them have a free slot
+package groups
+
+import (
+	"query-queue-worker/config"
+	"query-queue-worker/types"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Concurrency group with its query name patterns compiled
+type group struct {
+	name     string
+	limit    int
+	patterns []*regexp.Regexp // Query name patterns as anchored regular expressions
+	like     []string         // Query name patterns as SQL LIKE patterns
+}
+
+var compiled []group // Configured groups, sorted by name
+
+// Initializes package, compiling the query name patterns of the "worker.concurrency.groups" settings
+func Init() {
+	compiled = compile(config.Settings.Worker.Concurrency.Groups)
+}
+
+// Compiles the query name patterns of concurrency groups
+//
+// Parameters:
+//   - groups (map[string]types.AppConfigWorkerConcurrencyGroup) : Groups by name
+//
+// Returns:
+//   - []group : Groups sorted by name
+func compile(groups map[string]types.AppConfigWorkerConcurrencyGroup) []group {
+	var result = make([]group, 0, len(groups))
+	var replacer = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%", "?", "_")
+	for name, settings := range groups {
+		var compiledGroup = group{name: name, limit: settings.Limit}
+		for _, pattern := range settings.Queries {
+			compiledGroup.patterns = append(compiledGroup.patterns, globToRegexp(pattern))
+			compiledGroup.like = append(compiledGroup.like, replacer.Replace(pattern))
+		}
+		result = append(result, compiledGroup)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// Returns weather any concurrency group is configured
+func Enabled() bool {
+	return len(compiled) > 0
+}
+
+// Returns the names of every configured group, sorted by name
+func Names() []string {
+	var names = make([]string, len(compiled))
+	for i, group := range compiled {
+		names[i] = group.name
+	}
+	return names
+}
+
+// Returns the names of the groups a query belongs to
+//
+// Parameters:
+//   - queryName (string) : The "queryName" of the job
+//
+// Returns:
+//   - []string : Names of the matching groups, sorted by name
+func Match(queryName string) []string {
+	var names []string
+	for _, group := range compiled {
+		for _, pattern := range group.patterns {
+			if pattern.MatchString(queryName) {
+				names = append(names, group.name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// Returns the maximum number of jobs of a group allowed to run at once
+//
+// Parameters:
+//   - name (string) : Name of the group
+func Limit(name string) int {
+	if group := find(name); group != nil {
+		return group.limit
+	}
+	return 0
+}
+
+// Returns the query name patterns of a group converted to SQL LIKE patterns
+//
+// Parameters:
+//   - name (string) : Name of the group
+func LikePatterns(name string) []string {
+	if group := find(name); group != nil {
+		return group.like
+	}
+	return nil
+}
+
+// Returns a configured group by name, nil when there is none
+func find(name string) *group {
+	for i := range compiled {
+		if compiled[i].name == name {
+			return &compiled[i]
+		}
+	}
+	return nil
+}
+
+// Converts a wildcard pattern into an anchored regular expression
+//
+// Parameters:
+//   - pattern (string) : Query name pattern with "*" and "?" wildcards
+func globToRegexp(pattern string) *regexp.Regexp {
+	var expression = regexp.QuoteMeta(pattern)
+	expression = strings.ReplaceAll(expression, `\*`, ".*")
+	expression = strings.ReplaceAll(expression, `\?`, ".")
+	return regexp.MustCompile("^" + expression + "$")
+}
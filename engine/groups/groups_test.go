@@ -0,0 +1,85 @@
+package groups
+
+import (
+	"query-queue-worker/types"
+	"reflect"
+	"testing"
+)
+
+func setGroups(groups map[string]types.AppConfigWorkerConcurrencyGroup) {
+	compiled = compile(groups)
+}
+
+func TestMatch(t *testing.T) {
+	setGroups(map[string]types.AppConfigWorkerConcurrencyGroup{
+		"reports": {Limit: 2, Queries: []string{"report_*"}},
+		"exports": {Limit: 1, Queries: []string{"export_?", "report_sales"}},
+		"heavy":   {Limit: 1, Queries: []string{"*_full", "a.b+c"}},
+	})
+	var tests = []struct {
+		queryName string
+		groups    []string
+	}{
+		{"report_daily", []string{"reports"}},
+		{"report_", []string{"reports"}},
+		{"report_sales", []string{"exports", "reports"}},
+		{"report_full", []string{"heavy", "reports"}},
+		{"export_1", []string{"exports"}},
+		{"export_12", nil},
+		{"export_", nil},
+		{"my_report_daily", nil},
+		{"REPORT_DAILY", nil},
+		{"a.b+c", []string{"heavy"}},
+		{"aXb+c", nil},
+		{"abbc", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		if groups := Match(test.queryName); !reflect.DeepEqual(groups, test.groups) {
+			t.Errorf("Match(%q) = %v, want %v", test.queryName, groups, test.groups)
+		}
+	}
+}
+
+func TestLikePatterns(t *testing.T) {
+	setGroups(map[string]types.AppConfigWorkerConcurrencyGroup{
+		"reports": {Limit: 2, Queries: []string{"report*", "export_?", `100%\done`, "plain"}},
+	})
+	var want = []string{`report%`, `export\__`, `100\%\\done`, "plain"}
+	if patterns := LikePatterns("reports"); !reflect.DeepEqual(patterns, want) {
+		t.Errorf("LikePatterns(\"reports\") = %q, want %q", patterns, want)
+	}
+	if patterns := LikePatterns("unknown"); patterns != nil {
+		t.Errorf("LikePatterns(\"unknown\") = %q, want nil", patterns)
+	}
+}
+
+func TestLimit(t *testing.T) {
+	setGroups(map[string]types.AppConfigWorkerConcurrencyGroup{
+		"reports": {Limit: 2, Queries: []string{"report_*"}},
+		"exports": {Limit: 5, Queries: []string{"export_*"}},
+	})
+	var tests = []struct {
+		name  string
+		limit int
+	}{
+		{"reports", 2},
+		{"exports", 5},
+		{"unknown", 0},
+	}
+	for _, test := range tests {
+		if limit := Limit(test.name); limit != test.limit {
+			t.Errorf("Limit(%q) = %d, want %d", test.name, limit, test.limit)
+		}
+	}
+	if names := Names(); !reflect.DeepEqual(names, []string{"exports", "reports"}) {
+		t.Errorf("Names() = %v, want [exports reports]", names)
+	}
+	if !Enabled() {
+		t.Error("Enabled() = false, want true")
+	}
+	setGroups(nil)
+	if Enabled() {
+		t.Error("Enabled() = true without groups, want false")
+	}
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"query-queue-worker/database"
+	"query-queue-worker/log"
+	"query-queue-worker/metrics"
+	"time"
+)
+
+var failedCycles = 0 // Consecutive cycles skipped because the database could not be reached
+
+// Flags the engine as degraded after a cycle failed on a database error
+//
+// # Running jobs are left to finish, new jobs are not dispatched until a cycle succeeds again
+//
+// Parameters:
+//   - err (error) : Error that stopped the cycle
+//
+// Returns:
+//   - time.Duration : Time to wait before the next cycle, doubled on each consecutive failure up to "<driver>.retry.maxDelay"
+func cycleFailed(err error) time.Duration {
+	failedCycles++
+	metrics.DatabaseError("cycle")
+	metrics.SetDegraded(true)
+	engineMu.Lock()
+	if engine.Status != "stopped" {
+		engine.Status = "degraded"
+	}
+	engineMu.Unlock()
+	var retry = database.Sql.Retry()
+	var delay = time.Second * time.Duration(retry.Delay)
+	var maxDelay = time.Second * time.Duration(retry.MaxDelay)
+	for i := 1; i < failedCycles && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	log.Writer.Errorf("Database unavailable, skipping cycle (failure %d), retrying in %v: %v", failedCycles, delay, err.Error())
+	return delay
+}
+
+// Restores a degraded engine once a cycle succeeds again
+func cycleSucceeded() {
+	if failedCycles == 0 {
+		return
+	}
+	log.Writer.Infof("Database reachable again after %d failed cycles, resuming", failedCycles)
+	failedCycles = 0
+	metrics.SetDegraded(false)
+	engineMu.Lock()
+	if engine.Status == "degraded" {
+		engine.Status = "started"
+	}
+	engineMu.Unlock()
+}
@@ -0,0 +1,49 @@
+// Package history records every job execution on the run history table, so that past runs survive the next update of
+// their queue row, and purges old records according to the retention setting
+package history
+
+import (
+	"query-queue-worker/config"
+	"query-queue-worker/engine/store"
+	"query-queue-worker/log"
+	"query-queue-worker/metrics"
+	"query-queue-worker/types"
+	"query-queue-worker/util"
+	"time"
+)
+
+// Records a job execution
+//
+// Start and end times are stored relative to the database clock (end set to the current time) so that they are
+// comparable with the other date columns
+//
+// Parameters:
+//   - run (types.TblCRQueryQueueRun) : Execution data, "StartedAt" and "EndedAt" are ignored
+//   - duration (time.Duration) : Wall time taken by the job command
+func Record(run types.TblCRQueryQueueRun, duration time.Duration) {
+	if !config.Settings.Worker.History.Enabled {
+		return
+	}
+	run.Output = util.Tail(run.Output, config.Settings.Worker.History.OutputLength)
+	err := store.Queue.RecordRun(run, duration)
+	if err != nil {
+		metrics.DatabaseError("history")
+		log.Writer.Errorf("Cannot record run history of job #%s: %v", run.QuerySignature, err.Error())
+	}
+}
+
+// Deletes run history records older than the retention setting
+func Purge() {
+	if !config.Settings.Worker.History.Enabled || config.Settings.Worker.History.Retention <= 0 {
+		return
+	}
+	count, err := store.Queue.PurgeRuns(config.Settings.Worker.History.Retention)
+	if err != nil {
+		metrics.DatabaseError("history")
+		log.Writer.Errorf("Cannot purge run history: %v", err.Error())
+		return
+	}
+	if count > 0 {
+		log.Writer.Infof("Purged %d run history records older than %d days", count, config.Settings.Worker.History.Retention)
+	}
+}
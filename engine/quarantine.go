@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"errors"
+	"query-queue-worker/config"
+	"query-queue-worker/engine/store"
+	"query-queue-worker/engine/threads"
+	"query-queue-worker/log"
+	"query-queue-worker/metrics"
+	"query-queue-worker/types"
+)
+
+// Records the outcome of a job on the quarantine table
+//
+// Consecutive failures of a signature are counted, once they reach "worker.quarantine.failures" the signature is excluded
+// from lookups for "worker.quarantine.cooldown" seconds (or until released when the cool-down is 0). A successful run
+// clears the count. Signatures failing again after their cool-down are quarantined on their next failure.
+//
+// Parameters:
+//   - queue (store.Store) : Queue of the processed row
+//   - job (types.TblCRQueryQueue) : The processed row
+//   - threadType (string) : String representation of the threadType that processed the row (pending, update)
+//   - successful (bool) : Weather the job command succeeded
+//   - runError (string) : Failure description, empty for successful jobs
+func recordQuarantine(queue store.Store, job types.TblCRQueryQueue, threadType string, successful bool, runError string) {
+	var failures = config.Settings.Worker.Quarantine.Failures
+	if failures <= 0 {
+		return
+	}
+	// Successful runs clear the consecutive failures
+	if successful {
+		if err := queue.ClearFailures(job.QuerySignature); err != nil {
+			metrics.DatabaseError("quarantine")
+			log.Writer.Errorf("Cannot clear failures of job #%s: %v", jobLabel(queue, job.QuerySignature), err.Error())
+		}
+		return
+	}
+	// Count failure
+	if err := queue.CountFailure(job, threadType, truncateRunError(runError)); err != nil {
+		metrics.DatabaseError("quarantine")
+		log.Writer.Errorf("Cannot count failure of job #%s: %v", jobLabel(queue, job.QuerySignature), err.Error())
+		return
+	}
+	// Quarantine signatures that reached the failures threshold and are not already quarantined
+	quarantined, err := queue.Quarantine(job.QuerySignature, failures, config.Settings.Worker.Quarantine.Cooldown)
+	if err != nil {
+		metrics.DatabaseError("quarantine")
+		log.Writer.Errorf("Cannot quarantine job #%s: %v", jobLabel(queue, job.QuerySignature), err.Error())
+		return
+	}
+	if quarantined {
+		log.Writer.Warnf("Quarantined job #%s after %d consecutive failures", jobLabel(queue, job.QuerySignature), failures)
+	}
+}
+
+// Refreshes the quarantined signatures shown on the engine statistics
+func loadQuarantine() {
+	jobs, err := GetQuarantined()
+	if err != nil {
+		metrics.DatabaseError("quarantine")
+		log.Writer.Errorf("Cannot load quarantined jobs: %v", err.Error())
+		return
+	}
+	var pending, update []string
+	for _, job := range jobs {
+		switch job.Type {
+		case threads.Type.Pending:
+			pending = append(pending, job.Signature)
+		case threads.Type.Update:
+			update = append(update, job.Signature)
+		}
+	}
+	engineMu.Lock()
+	engine.Processes.Pending.Count.Blacklist = pending
+	engine.Processes.Update.Count.Blacklist = update
+	engineMu.Unlock()
+}
+
+// Returns the jobs currently quarantined, across all workers and queues
+//
+// Returns:
+//   - []types.EngineQuarantinedJob : Quarantined jobs, most recent first
+//   - error : Set when the quarantine table cannot be read
+func GetQuarantined() ([]types.EngineQuarantinedJob, error) {
+	return store.Queue.Quarantined()
+}
+
+// Releases a quarantined signature so that it is processed again, its consecutive failures are cleared
+//
+// Parameters:
+//   - queue (string) : Queue of the job, empty for the default queue
+//   - signature (string) : The "querySignature" of the job
+//
+// Returns:
+//   - error : Set when the queue is unknown, the signature is not quarantined or the quarantine table cannot be updated
+func Release(queue string, signature string) error {
+	queueStore, err := store.Find(queue)
+	if err != nil {
+		return err
+	}
+	released, err := queueStore.Release(signature)
+	if err != nil {
+		metrics.DatabaseError("quarantine")
+		return err
+	}
+	if !released {
+		return errors.New("job #" + jobLabel(queueStore, signature) + " is not quarantined")
+	}
+	log.Writer.Info("Released job #" + jobLabel(queueStore, signature) + " from quarantine")
+	Wake()
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package retry resolves the retry policy of failed jobs and computes their exponential backoff
+//
+// Policies are set on "worker.retry.default" and can be overridden per query name on "worker.retry.queries", keys
+// missing from an override are taken from the default policy
+package retry
+
+import (
+	"math"
+	"math/rand"
+	"query-queue-worker/config"
+	"query-queue-worker/types"
+	"time"
+)
+
+// Returns the retry policy of a query
+//
+// Parameters:
+//   - queryName (string) : The "queryName" of the job
+//
+// Returns:
+//   - types.AppConfigWorkerRetryPolicy : The default policy merged with the query override, when one exists
+func Policy(queryName string) types.AppConfigWorkerRetryPolicy {
+	var policy = config.Settings.Worker.Retry.Default
+	override, ok := config.Settings.Worker.Retry.Queries[queryName]
+	if !ok {
+		return policy
+	}
+	return config.MergeRetryPolicy(policy, override)
+}
+
+// Returns the highest number of attempts allowed by any policy
+func MaxAttempts() int {
+	var max = config.Settings.Worker.Retry.Default.MaxAttempts
+	for name := range config.Settings.Worker.Retry.Queries {
+		if attempts := Policy(name).MaxAttempts; attempts > max {
+			max = attempts
+		}
+	}
+	return max
+}
+
+// Computes the delay before the next attempt of a failed job
+//
+// The delay grows as "delay * multiplier ^ attempts", is capped by "maxDelay" (unless 0) and then randomized by +/- "jitter" (a
+// fraction of the delay) so that jobs failing together are not retried together
+//
+// Parameters:
+//   - policy (types.AppConfigWorkerRetryPolicy) : Retry policy of the job
+//   - attempts (int) : Number of retries already made
+//
+// Returns:
+//   - time.Duration : Delay until the next attempt
+func Delay(policy types.AppConfigWorkerRetryPolicy, attempts int) time.Duration {
+	var delay = float64(policy.Delay) * math.Pow(policy.Multiplier, float64(attempts))
+	if policy.MaxDelay > 0 && delay > float64(policy.MaxDelay) {
+		delay = float64(policy.MaxDelay)
+	}
+	if policy.Jitter > 0 {
+		delay += delay * policy.Jitter * (rand.Float64()*2 - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay * float64(time.Second))
+}
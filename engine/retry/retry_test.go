@@ -0,0 +1,52 @@
+package retry
+
+import (
+	"query-queue-worker/types"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	var tests = []struct {
+		policy   types.AppConfigWorkerRetryPolicy
+		attempts int
+		delay    time.Duration
+	}{
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, MaxDelay: 3600}, 0, 60 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, MaxDelay: 3600}, 1, 120 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, MaxDelay: 3600}, 3, 480 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, MaxDelay: 3600}, 6, 3600 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, MaxDelay: 3600}, 100, 3600 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 1, MaxDelay: 3600}, 5, 60 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 10, Multiplier: 1.5, MaxDelay: 3600}, 2, 22500 * time.Millisecond},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, MaxDelay: 0}, 10, 61440 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 0, Multiplier: 2, MaxDelay: 3600}, 4, 0},
+	}
+	for _, test := range tests {
+		if delay := Delay(test.policy, test.attempts); delay != test.delay {
+			t.Errorf("Delay(%+v, %d) = %v, want %v", test.policy, test.attempts, delay, test.delay)
+		}
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	var tests = []struct {
+		policy   types.AppConfigWorkerRetryPolicy
+		attempts int
+		min      time.Duration
+		max      time.Duration
+	}{
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 3600}, 0, 54 * time.Second, 66 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, Jitter: 0.5, MaxDelay: 3600}, 2, 120 * time.Second, 360 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, Jitter: 0.1, MaxDelay: 3600}, 10, 3240 * time.Second, 3960 * time.Second},
+		{types.AppConfigWorkerRetryPolicy{Delay: 60, Multiplier: 2, Jitter: 1, MaxDelay: 3600}, 0, 0, 120 * time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 1000; i++ {
+			if delay := Delay(test.policy, test.attempts); delay < test.min || delay > test.max {
+				t.Errorf("Delay(%+v, %d) = %v, want between %v and %v", test.policy, test.attempts, delay, test.min, test.max)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Package schedule computes the next run of repeating jobs from their "runRepeat" definition
+//
+// Supported definitions:
+//   - Number of seconds, EG: "3600"
+//   - GO durations, EG: "15m", "1h30m"
+//   - ISO-8601 durations, EG: "PT15M", "P1D", "P1W", "P1M"
+//   - Cron expressions with 5 fields (minute precision) or 6 fields (leading seconds field), EG: "*/15 * * * *"
+//   - Cron macros, EG: "@hourly", "@daily", "@weekly", "@monthly", "@yearly", "@every 10m"
+//
+// Calendar based definitions (cron expressions and ISO-8601 days, weeks, months and years) are evaluated on the timezone
+// set on "worker.timezone", cron expressions may override it with a "CRON_TZ=<zone>" prefix
+package schedule
+
+import (
+	"errors"
+	"github.com/robfig/cron/v3"
+	"query-queue-worker/config"
+	"query-queue-worker/util"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+var Location = time.Local // Timezone used to evaluate calendar based definitions
+
+var parser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// Initializes package
+func Init() {
+	if config.Settings.Worker.Timezone == "" {
+		return
+	}
+	location, err := time.LoadLocation(config.Settings.Worker.Timezone)
+	if err != nil {
+		util.Die("Error: invalid worker timezone\n %v\n", err.Error())
+	}
+	Location = location
+}
+
+// Returns the next run time of a repeating job
+//
+// Parameters:
+//   - repeat (string) : The "runRepeat" definition of the job
+//   - from (time.Time) : Time from which the next run is calculated, usually the end of the last run
+//
+// Returns:
+//   - time.Time : Time of the next run
+//   - error : Set when the definition cannot be parsed
+func Next(repeat string, from time.Time) (time.Time, error) {
+	repeat = strings.TrimSpace(repeat)
+	if repeat == "" {
+		return time.Time{}, errors.New("empty repeat definition")
+	}
+	// ISO-8601 durations
+	if strings.HasPrefix(repeat, "P") {
+		return nextIsoDuration(repeat, from)
+	}
+	// Seconds and GO durations
+	if interval, err := parseInterval(repeat); err == nil {
+		return from.Add(interval), nil
+	}
+	// Cron expressions and macros
+	return nextCron(repeat, from)
+}
+
+// Checks weather a repeat definition can be parsed
+//
+// Parameters:
+//   - repeat (string) : The "runRepeat" definition of the job
+//
+// Returns:
+//   - error : Set when the definition cannot be parsed
+func Validate(repeat string) error {
+	_, err := Next(repeat, time.Now())
+	return err
+}
+
+// Parses an interval definition, either as a number of seconds or as a GO duration
+//
+// Parameters:
+//   - repeat (string) : The interval definition
+//
+// Returns:
+//   - time.Duration : Parsed interval
+//   - error : Set when the definition cannot be parsed or is not positive
+func parseInterval(repeat string) (time.Duration, error) {
+	var interval time.Duration
+	if seconds, err := strconv.Atoi(repeat); err == nil {
+		interval = time.Duration(seconds) * time.Second
+	} else if duration, err := time.ParseDuration(repeat); err == nil {
+		interval = duration
+	} else {
+		return 0, errors.New("unsupported repeat definition \"" + repeat + "\"")
+	}
+	if interval <= 0 {
+		return 0, errors.New("repeat interval must be positive, got \"" + repeat + "\"")
+	}
+	return interval, nil
+}
+
+// Computes the next run from an ISO-8601 duration (EG: "P1DT12H")
+//
+// Parameters:
+//   - repeat (string) : The ISO-8601 duration
+//   - from (time.Time) : Time from which the next run is calculated
+//
+// Returns:
+//   - time.Time : Time of the next run
+//   - error : Set when the duration cannot be parsed or is empty
+func nextIsoDuration(repeat string, from time.Time) (time.Time, error) {
+	var parts = isoDuration.FindStringSubmatch(repeat)
+	if parts == nil || repeat == "P" || strings.HasSuffix(repeat, "T") {
+		return time.Time{}, errors.New("invalid ISO-8601 duration \"" + repeat + "\"")
+	}
+	var values = make([]int, len(parts))
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			values[i], _ = strconv.Atoi(parts[i])
+		}
+	}
+	// Calendar parts are applied on the configured timezone so that days keep their wall clock time across DST changes
+	var next = from.In(Location).AddDate(values[1], values[2], values[3]*7+values[4])
+	next = next.Add(time.Duration(values[5])*time.Hour + time.Duration(values[6])*time.Minute + time.Duration(values[7])*time.Second)
+	if !next.After(from) {
+		return time.Time{}, errors.New("ISO-8601 duration must be positive, got \"" + repeat + "\"")
+	}
+	return next, nil
+}
+
+// Computes the next run from a cron expression or macro
+//
+// Parameters:
+//   - repeat (string) : The cron expression
+//   - from (time.Time) : Time from which the next run is calculated
+//
+// Returns:
+//   - time.Time : Time of the next run
+//   - error : Set when the expression cannot be parsed or never matches
+func nextCron(repeat string, from time.Time) (time.Time, error) {
+	// Evaluate on the configured timezone unless the expression sets its own
+	if !strings.HasPrefix(repeat, "CRON_TZ=") && !strings.HasPrefix(repeat, "TZ=") {
+		repeat = "CRON_TZ=" + Location.String() + " " + repeat
+	}
+	spec, err := parser.Parse(repeat)
+	if err != nil {
+		return time.Time{}, errors.New("invalid cron expression: " + err.Error())
+	}
+	var next = spec.Next(from)
+	if next.IsZero() {
+		return time.Time{}, errors.New("cron expression never matches")
+	}
+	return next, nil
+}
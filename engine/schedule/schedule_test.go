@@ -0,0 +1,102 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	Location = time.UTC
+	var from = time.Date(2024, 1, 31, 10, 20, 30, 0, time.UTC)
+	var tests = []struct {
+		repeat string
+		next   time.Time
+	}{
+		{"60", from.Add(time.Minute)},
+		{" 3600 ", from.Add(time.Hour)},
+		{"15m", from.Add(15 * time.Minute)},
+		{"1h30m", from.Add(90 * time.Minute)},
+		{"PT15M", from.Add(15 * time.Minute)},
+		{"PT1H30M15S", from.Add(time.Hour + 30*time.Minute + 15*time.Second)},
+		{"P1D", time.Date(2024, 2, 1, 10, 20, 30, 0, time.UTC)},
+		{"P1W", time.Date(2024, 2, 7, 10, 20, 30, 0, time.UTC)},
+		{"P1M", time.Date(2024, 3, 2, 10, 20, 30, 0, time.UTC)},
+		{"P1Y", time.Date(2025, 1, 31, 10, 20, 30, 0, time.UTC)},
+		{"P1DT12H", time.Date(2024, 2, 1, 22, 20, 30, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 2, 1, 2, 0, 0, 0, time.UTC)},
+		{"30 */5 * * * *", time.Date(2024, 1, 31, 10, 25, 30, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 10m", from.Add(10 * time.Minute)},
+		{"CRON_TZ=Asia/Tokyo 0 9 * * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		next, err := Next(test.repeat, from)
+		if err != nil {
+			t.Errorf("Next(%q) returned error: %v", test.repeat, err)
+			continue
+		}
+		if !next.Equal(test.next) {
+			t.Errorf("Next(%q) = %v, want %v", test.repeat, next, test.next)
+		}
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("timezone database not available")
+	}
+	Location = tokyo
+	defer func() { Location = time.UTC }()
+	var from = time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)
+	next, err := Next("0 9 * * *", from)
+	if err != nil {
+		t.Fatalf("Next returned error: %v", err)
+	}
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("Next = %v, want %v", next, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	Location = time.UTC
+	var tests = []struct {
+		repeat string
+		valid  bool
+	}{
+		{"60", true},
+		{"15m", true},
+		{"PT15M", true},
+		{"P1DT12H", true},
+		{"0 2 * * *", true},
+		{"@weekly", true},
+		{"@every 1h", true},
+		{"", false},
+		{"   ", false},
+		{"0", false},
+		{"-60", false},
+		{"-5m", false},
+		{"P", false},
+		{"PT", false},
+		{"P0D", false},
+		{"P1DT", false},
+		{"P1H", false},
+		{"PT1D", false},
+		{"bogus", false},
+		{"61 * * * *", false},
+		{"* * *", false},
+		{"0 0 30 2 *", false},
+		{"CRON_TZ=Nowhere/Unknown 0 2 * * *", false},
+	}
+	for _, test := range tests {
+		var err = Validate(test.repeat)
+		if test.valid && err != nil {
+			t.Errorf("Validate(%q) returned error: %v", test.repeat, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Validate(%q) returned no error", test.repeat)
+		}
+	}
+}
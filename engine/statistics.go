@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"query-queue-worker/config"
+	"query-queue-worker/engine/store"
+	"query-queue-worker/engine/threads"
+	"query-queue-worker/log"
+	"query-queue-worker/metrics"
+	"query-queue-worker/types"
+	"sync"
+	"time"
+)
+
+// Statistics gathered since the last flush, per process type and query name (empty for the process type aggregate)
+type statsDelta struct {
+	processType string
+	queryName   string
+	count       types.EngineProcessTypeCounts
+	lastError   string
+}
+
+var deltas = map[[2]string]*statsDelta{}
+var deltasMu = sync.Mutex{}
+var lastFlush = time.Now()
+
+// Loads the persisted statistics of each process type and query name into the engine statistics
+//
+// Persisted statistics are the totals of every worker using the same database, each worker adds its own runs to them.
+// Once loaded, a worker shows the totals of the whole fleet at the time it started plus its own runs since
+func loadStats() {
+	processes, err := store.Queue.LoadStats()
+	if err != nil {
+		metrics.DatabaseError("stats")
+		log.Writer.Errorf("Cannot load engine statistics: %v", err.Error())
+		return
+	}
+	engineMu.Lock()
+	defer engineMu.Unlock()
+	for processType, loaded := range processes {
+		var process = processStats(processType)
+		if process == nil {
+			continue
+		}
+		process.Queries = loaded.Queries
+		process.Count.Total = loaded.Count.Total
+		process.Count.Successful = loaded.Count.Successful
+		process.Count.Failed = loaded.Count.Failed
+		process.Count.TimedOut = loaded.Count.TimedOut
+		if !loaded.LastRun.IsZero() {
+			process.LastRun = loaded.LastRun
+		}
+	}
+}
+
+// Returns the engine statistics of a process type, the engine lock must be held by the caller
+//
+// Parameters:
+//   - processType (string) : Reference to the types.EngineThreadsProcessType as string
+//
+// Returns:
+//   - *types.EngineProcessType : Statistics of the process type, nil for unknown process types
+func processStats(processType string) *types.EngineProcessType {
+	switch processType {
+	case threads.Type.Pending:
+		return &engine.Processes.Pending
+	case threads.Type.Update:
+		return &engine.Processes.Update
+	case threads.Type.Maintenance:
+		return &engine.Processes.Maintenance
+	}
+	return nil
+}
+
+// Adds a job outcome to the engine statistics of its query name
+//
+// Parameters:
+//   - processType (string) : Reference to the types.EngineThreadsProcessType as string
+//   - queryName (string) : The "queryName" of the job
+//   - successful (bool) : Weather the job command succeeded
+//   - timedOut (bool) : Weather the job was killed for exceeding its timeout
+//   - runError (string) : Failure description, empty for successful jobs
+func addQueryStats(processType string, queryName string, successful bool, timedOut bool, runError string) {
+	engineMu.Lock()
+	defer engineMu.Unlock()
+	var process = processStats(processType)
+	if process == nil {
+		return
+	}
+	if process.Queries == nil {
+		process.Queries = map[string]types.EngineQueryStats{}
+	}
+	var stats = process.Queries[queryName]
+	stats.LastRun = time.Now()
+	stats.Total++
+	if successful {
+		stats.Successful++
+	} else {
+		stats.Failed++
+		stats.LastError = truncateRunError(runError)
+	}
+	if timedOut {
+		stats.TimedOut++
+	}
+	process.Queries[queryName] = stats
+}
+
+// Returns a copy of the statistics of each query name
+//
+// Parameters:
+//   - queries (map[string]types.EngineQueryStats) : Statistics to copy
+//
+// Returns:
+//   - map[string]types.EngineQueryStats : Copy that can be read without holding the engine lock
+func copyQueryStats(queries map[string]types.EngineQueryStats) map[string]types.EngineQueryStats {
+	var copied = make(map[string]types.EngineQueryStats, len(queries))
+	for name, stats := range queries {
+		copied[name] = stats
+	}
+	return copied
+}
+
+// Adds a job outcome to the statistics waiting to be persisted
+//
+// Parameters:
+//   - processType (string) : Reference to the types.EngineThreadsProcessType as string
+//   - queryName (string) : The "queryName" of the job
+//   - successful (bool) : Weather the job command succeeded
+//   - timedOut (bool) : Weather the job was killed for exceeding its timeout
+//   - runError (string) : Failure description, empty for successful jobs
+func queueStats(processType string, queryName string, successful bool, timedOut bool, runError string) {
+	deltasMu.Lock()
+	defer deltasMu.Unlock()
+	for _, name := range []string{"", queryName} {
+		var key = [2]string{processType, name}
+		if deltas[key] == nil {
+			deltas[key] = &statsDelta{processType: processType, queryName: name}
+		}
+		var delta = deltas[key]
+		delta.count.Total++
+		if successful {
+			delta.count.Successful++
+		} else {
+			delta.count.Failed++
+			delta.lastError = truncateRunError(runError)
+		}
+		if timedOut {
+			delta.count.TimedOut++
+		}
+	}
+}
+
+// Persists the statistics gathered since the last flush once the "worker.stats.flush" interval has elapsed
+//
+// Parameters:
+//   - force (bool) : Flush regardless of the interval (EG: on shutdown)
+func flushStats(force bool) {
+	if !force && time.Since(lastFlush) < time.Second*time.Duration(config.Settings.Worker.Stats.Flush) {
+		return
+	}
+	lastFlush = time.Now()
+	// Take pending deltas
+	deltasMu.Lock()
+	var pending = deltas
+	deltas = map[[2]string]*statsDelta{}
+	deltasMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	for key, delta := range pending {
+		err := store.Queue.AddStats(delta.processType, delta.queryName, delta.count, delta.lastError)
+		if err != nil {
+			metrics.DatabaseError("stats")
+			log.Writer.Errorf("Cannot persist engine statistics: %v", err.Error())
+			// Keep delta for the next flush
+			restoreStats(key, delta)
+		}
+	}
+}
+
+// Merges back a delta that could not be persisted
+func restoreStats(key [2]string, delta *statsDelta) {
+	deltasMu.Lock()
+	defer deltasMu.Unlock()
+	var current = deltas[key]
+	if current == nil {
+		deltas[key] = delta
+		return
+	}
+	current.count.Total += delta.count.Total
+	current.count.Successful += delta.count.Successful
+	current.count.Failed += delta.count.Failed
+	current.count.TimedOut += delta.count.TimedOut
+	if current.lastError == "" {
+		current.lastError = delta.lastError
+	}
+}
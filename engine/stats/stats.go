@@ -20,6 +20,7 @@ func ShowTable() {
 			strconv.Itoa(engineData.Processes.Pending.Count.Total),
 			strconv.Itoa(engineData.Processes.Pending.Count.Successful),
 			strconv.Itoa(engineData.Processes.Pending.Count.Failed),
+			strconv.Itoa(engineData.Processes.Pending.Count.TimedOut),
 			strconv.Itoa(len(engineData.Processes.Pending.Count.Blacklist)),
 		},
 		[]string{
@@ -28,20 +29,23 @@ func ShowTable() {
 			strconv.Itoa(engineData.Processes.Update.Count.Total),
 			strconv.Itoa(engineData.Processes.Update.Count.Successful),
 			strconv.Itoa(engineData.Processes.Update.Count.Failed),
+			strconv.Itoa(engineData.Processes.Update.Count.TimedOut),
 			strconv.Itoa(len(engineData.Processes.Update.Count.Blacklist)),
 		},
 		[]string{
 			"Maintenance",
-			engineData.Processes.Update.LastRun.Format("15:04:05"),
-			strconv.Itoa(engineData.Processes.Update.Count.Total),
+			engineData.Processes.Maintenance.LastRun.Format("15:04:05"),
+			strconv.Itoa(engineData.Processes.Maintenance.Count.Total),
 			"--",
-			strconv.Itoa(engineData.Processes.Update.Count.Failed),
+			strconv.Itoa(engineData.Processes.Maintenance.Count.Failed),
+			strconv.Itoa(engineData.Processes.Maintenance.Count.TimedOut),
 			"--",
 		},
 	}
 	// Init new table
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Process Type", "Last Run", "Total", "Successful", "Failed", "Blacklist"})
+	table.SetHeader([]string{"Process Type", "Last Run", "Total", "Successful", "Failed", "Timed Out", "Blacklist"})
+	table.SetCaption(true, "Engine status: "+engineData.Status)
 	for _, v := range data {
 		table.Append(v)
 	}
@@ -0,0 +1,763 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"query-queue-worker/config"
+	"query-queue-worker/database"
+	"query-queue-worker/engine/groups"
+	"query-queue-worker/log"
+	"query-queue-worker/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store running portable SQL on the database connection, the differences between servers are left to database.Sql
+//
+// Statements on the queue table are written with Table.Expand placeholders so that they run on the table of the queue
+type sqlStore struct {
+	table Table
+}
+
+const pendingWaitingSince = "COALESCE({runNext}, {runFirst})" // SQL expression of the time since when a "pending" row is waiting
+const updateWaitingSince = "COALESCE({runNext}, {runLast})"   // SQL expression of the time since when an "update" row is waiting
+
+// SQL condition excluding rows whose signature is quarantined
+const notQuarantinedCondition = `{querySignature} NOT IN (
+	SELECT querySignature
+	FROM tblCRQueryQueueQuarantine
+	WHERE queueName = {queue} AND quarantinedAt IS NOT NULL AND (releaseAt IS NULL OR releaseAt > CURRENT_TIMESTAMP)
+)`
+
+const pendingCondition = "{runStatus} = 'pending' AND ({runNext} IS NULL OR {runNext} <= CURRENT_TIMESTAMP) AND " + notQuarantinedCondition                              // SQL condition of rows waiting for a "pending" job
+const updateCondition = "{runStatus} = 'completed' AND {runRepeat} IS NOT NULL AND ({runNext} IS NULL OR {runNext} <= CURRENT_TIMESTAMP) AND " + notQuarantinedCondition // SQL condition of rows waiting for an "update" job
+
+func (s sqlStore) Name() string {
+	return s.table.Queue
+}
+
+func (s sqlStore) CheckTable() error {
+	rows, err := database.Query("SELECT COUNT(*) FROM " + s.table.Name + " WHERE 1 = 0")
+	if err != nil {
+		return fmt.Errorf("cannot read %s table of queue %s: %v", s.table.Name, s.table.Queue, err)
+	}
+	rows.Close()
+	// Select each column on its own so that every missing one is reported
+	var missing []string
+	for _, column := range config.QueueColumns() {
+		rows, err = database.Query("SELECT " + s.table.Column(column) + " FROM " + s.table.Name + " WHERE 1 = 0")
+		if err != nil {
+			missing = append(missing, s.table.Column(column))
+			continue
+		}
+		rows.Close()
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf(
+			"%s table of queue %s is missing columns: %s. Add them as on tblCRQueryQueue or map them on worker.queues.%s.columns",
+			s.table.Name, s.table.Queue, strings.Join(missing, ", "), s.table.Queue,
+		)
+	}
+	return nil
+}
+
+func (s sqlStore) Lookup() (pending int, update int, pendingPriority int, updatePriority int, err error) {
+	var query = `
+		SELECT
+			COUNT(CASE WHEN {runStatus} = 'pending' THEN 1 END) AS TotalPending,
+			COUNT(CASE WHEN {runStatus} = 'completed' THEN 1 END) AS TotalUpdate,
+			COALESCE(MAX(CASE WHEN {runStatus} = 'pending' THEN ` + priorityExpression(pendingWaitingSince) + ` END), 0) AS PendingPriority,
+			COALESCE(MAX(CASE WHEN {runStatus} = 'completed' THEN ` + priorityExpression(updateWaitingSince) + ` END), 0) AS UpdatePriority
+		FROM {table}
+		WHERE
+			(` + pendingCondition + `) OR
+			(` + updateCondition + `)`
+	err = database.QueryRow(s.table.Expand(query)).Scan(&pending, &update, &pendingPriority, &updatePriority)
+	if err != nil {
+		err = fmt.Errorf("cannot select allocation from %s table: %v", s.table.Name, err)
+	}
+	return
+}
+
+func (s sqlStore) ClaimPending(owner string, limit int) ([]types.TblCRQueryQueue, error) {
+	return s.claim(
+		pendingCondition,
+		priorityExpression(pendingWaitingSince)+" DESC, {runFirst} IS NULL DESC, {pkQueryQueueID} ASC",
+		owner,
+		limit,
+	)
+}
+
+func (s sqlStore) ClaimUpdate(owner string, limit int) ([]types.TblCRQueryQueue, error) {
+	return s.claim(
+		updateCondition,
+		priorityExpression(updateWaitingSince)+" DESC, {runFirst} IS NULL DESC, {runLast} IS NULL DESC, {pkQueryQueueID} ASC",
+		owner,
+		limit,
+	)
+}
+
+func (s sqlStore) Heartbeat(job types.TblCRQueryQueue, owner string) error {
+	var query = `
+		UPDATE {table}
+		SET {leaseExpires} = ` + database.Sql.AddInterval("CURRENT_TIMESTAMP", "SECOND") + `
+		WHERE
+			{pkQueryQueueID} = ? AND
+			{claimedBy} = ? AND
+			{runStatus} = 'processing'`
+	_, err := database.Exec(s.table.Expand(query), config.Settings.Worker.Lease.Timeout, job.PkQueryQueueID, owner)
+	return err
+}
+
+func (s sqlStore) Recover(maxRecoveries int) (recovered int64, failed int64, err error) {
+	// Fail jobs that exhausted their recoveries
+	var query = `
+		UPDATE {table}
+		SET
+			{runStatus} = 'failed',
+			{runError} = ` + database.Sql.Concat("'Lease expired on worker '", "COALESCE({claimedBy}, 'unknown')", "' after '", "{recoveries}", "' recoveries'") + `,
+			{claimedBy} = NULL,
+			{claimedAt} = NULL,
+			{leaseExpires} = NULL
+		WHERE
+			{runStatus} = 'processing' AND
+			{leaseExpires} < CURRENT_TIMESTAMP AND
+			{recoveries} >= ?`
+	result, err := database.Exec(s.table.Expand(query), maxRecoveries)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot fail expired tasks on %s table: %v", s.table.Name, err)
+	}
+	failed, _ = result.RowsAffected()
+	// Return the remaining expired jobs to the queue
+	query = `
+		UPDATE {table}
+		SET
+			{runStatus} = 'pending',
+			{recoveries} = {recoveries} + 1,
+			{claimedBy} = NULL,
+			{claimedAt} = NULL,
+			{leaseExpires} = NULL
+		WHERE
+			{runStatus} = 'processing' AND
+			{leaseExpires} < CURRENT_TIMESTAMP`
+	result, err = database.Exec(s.table.Expand(query))
+	if err != nil {
+		return 0, failed, fmt.Errorf("cannot recover expired tasks on %s table: %v", s.table.Name, err)
+	}
+	recovered, _ = result.RowsAffected()
+	return recovered, failed, nil
+}
+
+func (s sqlStore) Retryable(maxAttempts int) ([]types.TblCRQueryQueue, error) {
+	var query = `
+		SELECT
+			{pkQueryQueueID},
+			{querySignature},
+			{queryName},
+			COALESCE({runRepeat}, ''),
+			{attempts}
+		FROM {table}
+		WHERE
+			{runStatus} = 'failed' AND
+			{attempts} < ?`
+	results, err := database.Query(s.table.Expand(query), maxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot select failed tasks from %s table: %v", s.table.Name, err)
+	}
+	defer results.Close()
+	var jobs []types.TblCRQueryQueue
+	for results.Next() {
+		var row = types.TblCRQueryQueue{}
+		err = results.Scan(&row.PkQueryQueueID, &row.QuerySignature, &row.QueryName, &row.RunRepeat, &row.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan failed tasks from %s table: %v", s.table.Name, err)
+		}
+		jobs = append(jobs, row)
+	}
+	return jobs, results.Err()
+}
+
+func (s sqlStore) Retry(job types.TblCRQueryQueue, delay time.Duration) error {
+	var query = `
+		UPDATE {table}
+		SET
+			{runStatus} = 'pending',
+			{runNext} = ` + database.Sql.AddInterval("CURRENT_TIMESTAMP", "SECOND") + `,
+			{attempts} = {attempts} + 1
+		WHERE
+			{pkQueryQueueID} = ? AND
+			{runStatus} = 'failed' AND
+			{attempts} = ?`
+	_, err := database.Exec(s.table.Expand(query), int(delay.Seconds()), job.PkQueryQueueID, job.Attempts)
+	return err
+}
+
+func (s sqlStore) Repeating() ([]types.TblCRQueryQueue, error) {
+	var query = `
+		SELECT
+			{pkQueryQueueID},
+			{querySignature},
+			{runRepeat}
+		FROM {table}
+		WHERE
+			{runRepeat} IS NOT NULL AND
+			{runStatus} != 'failed'`
+	results, err := database.Query(s.table.Expand(query))
+	if err != nil {
+		return nil, fmt.Errorf("cannot select repeating tasks from %s table: %v", s.table.Name, err)
+	}
+	defer results.Close()
+	var jobs []types.TblCRQueryQueue
+	for results.Next() {
+		var row = types.TblCRQueryQueue{}
+		err = results.Scan(&row.PkQueryQueueID, &row.QuerySignature, &row.RunRepeat)
+		if err != nil {
+			return nil, fmt.Errorf("cannot scan repeating tasks from %s table: %v", s.table.Name, err)
+		}
+		jobs = append(jobs, row)
+	}
+	return jobs, results.Err()
+}
+
+func (s sqlStore) MarkFailed(job types.TblCRQueryQueue, owner string, runError string) error {
+	return s.release(job, owner, "failed", runError)
+}
+
+func (s sqlStore) MarkCancelled(job types.TblCRQueryQueue, owner string, runError string) error {
+	return s.release(job, owner, "cancelled", runError)
+}
+
+func (s sqlStore) Requeue(job types.TblCRQueryQueue, owner string, status string) error {
+	var query = `
+		UPDATE {table}
+		SET
+			{runStatus} = ?,
+			{claimedBy} = NULL,
+			{claimedAt} = NULL,
+			{leaseExpires} = NULL
+		WHERE
+			{pkQueryQueueID} = ? AND
+			{claimedBy} = ? AND
+			{runStatus} = 'processing'`
+	_, err := database.Exec(s.table.Expand(query), status, job.PkQueryQueueID, owner)
+	return err
+}
+
+func (s sqlStore) MarkFinished(job types.TblCRQueryQueue, owner string, status string, runError string, runTime time.Duration, runNext *time.Duration) error {
+	var storedError interface{} = nil
+	if runError != "" {
+		storedError = runError
+	}
+	// Stored as an offset to the database clock so that it is comparable with CURRENT_TIMESTAMP
+	var nextIn interface{} = nil
+	if runNext != nil {
+		nextIn = int(runNext.Seconds())
+	}
+	var query = `
+		UPDATE {table}
+		SET
+			{runStatus} = ?,
+			{runError} = ?,
+			{runTime} = ?,
+			{runLast} = CURRENT_TIMESTAMP,
+			{runNext} = ` + database.Sql.AddInterval("CURRENT_TIMESTAMP", "SECOND") + `,
+			{attempts} = CASE WHEN ? THEN 0 ELSE {attempts} END,
+			{claimedBy} = NULL,
+			{claimedAt} = NULL,
+			{leaseExpires} = NULL
+		WHERE
+			{pkQueryQueueID} = ? AND
+			{claimedBy} = ?`
+	_, err := database.Exec(s.table.Expand(query), status, storedError, int(runTime.Seconds()), nextIn, status == "completed", job.PkQueryQueueID, owner)
+	return err
+}
+
+func (s sqlStore) MarkCompleted(job types.TblCRQueryQueue, owner string, runNext *time.Duration) error {
+	// Stored as an offset to the database clock so that it is comparable with CURRENT_TIMESTAMP, kept when not set
+	var nextIn interface{} = nil
+	if runNext != nil {
+		nextIn = int(runNext.Seconds())
+	}
+	// Release the claim in a single statement so that rows claimed since by another worker are left untouched. Rows left on
+	// "processing" by their command are completed as the command succeeded, the status is matched both before and after
+	// its update as MYSQL applies assignments in order
+	var query = `
+		UPDATE {table}
+		SET
+			{runStatus} = CASE WHEN {runStatus} = 'processing' THEN 'completed' ELSE {runStatus} END,
+			{attempts} = CASE WHEN {runStatus} IN ('processing', 'completed') THEN 0 ELSE {attempts} END,
+			{runNext} = CASE
+				WHEN {runStatus} IN ('processing', 'completed') THEN COALESCE(` + database.Sql.AddInterval("CURRENT_TIMESTAMP", "SECOND") + `, {runNext})
+				ELSE {runNext}
+			END,
+			{claimedBy} = NULL,
+			{claimedAt} = NULL,
+			{leaseExpires} = NULL
+		WHERE
+			{pkQueryQueueID} = ? AND
+			{claimedBy} = ?`
+	_, err := database.Exec(s.table.Expand(query), nextIn, job.PkQueryQueueID, owner)
+	return err
+}
+
+func (s sqlStore) ClearFailures(signature string) error {
+	_, err := database.Exec("DELETE FROM tblCRQueryQueueQuarantine WHERE queueName = ? AND querySignature = ?", s.table.Queue, signature)
+	return err
+}
+
+func (s sqlStore) CountFailure(job types.TblCRQueryQueue, processType string, runError string) error {
+	var query = `
+		INSERT INTO tblCRQueryQueueQuarantine (queueName, querySignature, queryName, processType, failures, lastError)
+		VALUES (?, ?, ?, ?, 1, ?)
+		` + database.Sql.Upsert("queueName", "querySignature") + `
+			queryName = ` + database.Sql.Inserted("queryName") + `,
+			processType = ` + database.Sql.Inserted("processType") + `,
+			failures = tblCRQueryQueueQuarantine.failures + 1,
+			lastError = ` + database.Sql.Inserted("lastError")
+	_, err := database.Exec(query, s.table.Queue, job.QuerySignature, job.QueryName, processType, runError)
+	return err
+}
+
+func (s sqlStore) Quarantine(signature string, failures int, cooldown int) (bool, error) {
+	// Quarantine signatures that reached the failures threshold and are not already quarantined
+	var releaseAt = "NULL"
+	var params []interface{}
+	if cooldown > 0 {
+		releaseAt = database.Sql.AddInterval("CURRENT_TIMESTAMP", "SECOND")
+		params = append(params, cooldown)
+	}
+	params = append(params, s.table.Queue, signature, failures)
+	var query = `
+		UPDATE tblCRQueryQueueQuarantine
+		SET
+			quarantinedAt = CURRENT_TIMESTAMP,
+			releaseAt = ` + releaseAt + `
+		WHERE
+			queueName = ? AND
+			querySignature = ? AND
+			failures >= ? AND
+			(quarantinedAt IS NULL OR (releaseAt IS NOT NULL AND releaseAt <= CURRENT_TIMESTAMP))`
+	result, err := database.Exec(query, params...)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+func (sqlStore) Quarantined() ([]types.EngineQuarantinedJob, error) {
+	var jobs = []types.EngineQuarantinedJob{}
+	var query = `
+		SELECT
+			queueName,
+			querySignature,
+			queryName,
+			processType,
+			failures,
+			COALESCE(lastError, ''),
+			COALESCE(` + database.Sql.Text("quarantinedAt") + `, ''),
+			COALESCE(` + database.Sql.Text("releaseAt") + `, '')
+		FROM tblCRQueryQueueQuarantine
+		WHERE quarantinedAt IS NOT NULL AND (releaseAt IS NULL OR releaseAt > CURRENT_TIMESTAMP)
+		ORDER BY quarantinedAt DESC`
+	results, err := database.Query(query)
+	if err != nil {
+		return jobs, err
+	}
+	defer results.Close()
+	for results.Next() {
+		var job = types.EngineQuarantinedJob{}
+		err = results.Scan(&job.Queue, &job.Signature, &job.Name, &job.Type, &job.Failures, &job.LastError, &job.QuarantinedAt, &job.ReleaseAt)
+		if err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, results.Err()
+}
+
+func (s sqlStore) Release(signature string) (bool, error) {
+	var query = `
+		DELETE FROM tblCRQueryQueueQuarantine
+		WHERE
+			queueName = ? AND
+			querySignature = ? AND
+			quarantinedAt IS NOT NULL AND
+			(releaseAt IS NULL OR releaseAt > CURRENT_TIMESTAMP)`
+	result, err := database.Exec(query, s.table.Queue, signature)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+func (sqlStore) LoadStats() (map[string]types.EngineProcessType, error) {
+	var query = `
+		SELECT
+			processType,
+			total,
+			successful,
+			failed,
+			timedOut,
+			COALESCE(` + database.Sql.SecondsSince("lastRun") + `, -1),
+			queryName,
+			COALESCE(lastError, '')
+		FROM tblCRQueryQueueStats`
+	results, err := database.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	var processes = map[string]types.EngineProcessType{}
+	for results.Next() {
+		var processType, queryName string
+		var lastRunAgo int64
+		var stats = types.EngineQueryStats{}
+		err = results.Scan(&processType, &stats.Total, &stats.Successful, &stats.Failed, &stats.TimedOut, &lastRunAgo, &queryName, &stats.LastError)
+		if err != nil {
+			return nil, err
+		}
+		// Read as an age on the database clock, so that the session timezone of the stored date does not matter
+		if lastRunAgo >= 0 {
+			stats.LastRun = time.Now().Add(-time.Second * time.Duration(lastRunAgo))
+		}
+		var process = processes[processType]
+		if queryName == "" {
+			process.LastRun = stats.LastRun
+			process.Count.Total = stats.Total
+			process.Count.Successful = stats.Successful
+			process.Count.Failed = stats.Failed
+			process.Count.TimedOut = stats.TimedOut
+		} else {
+			if process.Queries == nil {
+				process.Queries = map[string]types.EngineQueryStats{}
+			}
+			process.Queries[queryName] = stats
+		}
+		processes[processType] = process
+	}
+	return processes, results.Err()
+}
+
+func (sqlStore) AddStats(processType string, queryName string, count types.EngineProcessTypeCounts, lastError string) error {
+	var storedError interface{} = nil
+	if lastError != "" {
+		storedError = lastError
+	}
+	var query = `
+		INSERT INTO tblCRQueryQueueStats (processType, queryName, total, successful, failed, timedOut, lastRun, lastError)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+		` + database.Sql.Upsert("processType", "queryName") + `
+			total = tblCRQueryQueueStats.total + ` + database.Sql.Inserted("total") + `,
+			successful = tblCRQueryQueueStats.successful + ` + database.Sql.Inserted("successful") + `,
+			failed = tblCRQueryQueueStats.failed + ` + database.Sql.Inserted("failed") + `,
+			timedOut = tblCRQueryQueueStats.timedOut + ` + database.Sql.Inserted("timedOut") + `,
+			lastRun = ` + database.Sql.Inserted("lastRun") + `,
+			lastError = COALESCE(` + database.Sql.Inserted("lastError") + `, tblCRQueryQueueStats.lastError),
+			updatedAt = CURRENT_TIMESTAMP`
+	_, err := database.Exec(query, processType, queryName, count.Total, count.Successful, count.Failed, count.TimedOut, storedError)
+	return err
+}
+
+func (sqlStore) RecordRun(run types.TblCRQueryQueueRun, duration time.Duration) error {
+	var exitCode interface{} = nil
+	if run.ExitCode >= 0 {
+		exitCode = run.ExitCode
+	}
+	var output interface{} = nil
+	if run.Output != "" {
+		output = run.Output
+	}
+	// Start and end are relative to the database clock so that they are comparable with the other date columns
+	var query = `
+		INSERT INTO tblCRQueryQueueRun (
+			queueName, querySignature, queryName, processType, workerId, threadId, runStatus, exitCode,
+			startedAt, endedAt, durationMs, output
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ` + database.Sql.AddInterval(database.Sql.NowPrecise(), "MICROSECOND") + `, ` + database.Sql.NowPrecise() + `, ?, ?)`
+	_, err := database.Exec(
+		query,
+		run.QueueName, run.QuerySignature, run.QueryName, run.ProcessType, run.WorkerId, run.ThreadId, run.RunStatus, exitCode,
+		-duration.Microseconds(), duration.Milliseconds(), output,
+	)
+	return err
+}
+
+func (sqlStore) PurgeRuns(days int) (int64, error) {
+	var query = `
+		DELETE FROM tblCRQueryQueueRun
+		WHERE startedAt < ` + database.Sql.AddInterval("CURRENT_TIMESTAMP", "DAY")
+	result, err := database.Exec(query, -days)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Flags a row claimed by a worker with a final status and releases its claim
+//
+// Parameters:
+//   - job (types.TblCRQueryQueue) : The claimed row
+//   - owner (string) : Identity of the claiming worker
+//   - status (string) : Final "runStatus" of the row (EG: "failed")
+//   - runError (string) : Failure description stored in the "runError" column
+//
+// Returns:
+//   - error : Set when the row cannot be updated
+func (s sqlStore) release(job types.TblCRQueryQueue, owner string, status string, runError string) error {
+	var query = `
+		UPDATE {table}
+		SET
+			{runStatus} = ?,
+			{runError} = ?,
+			{claimedBy} = NULL,
+			{claimedAt} = NULL,
+			{leaseExpires} = NULL
+		WHERE
+			{pkQueryQueueID} = ? AND
+			{claimedBy} = ?`
+	_, err := database.Exec(s.table.Expand(query), status, runError, job.PkQueryQueueID, owner)
+	return err
+}
+
+// Builds the SQL expression of a row effective priority
+//
+// Rows gain one priority level for each "worker.priority.aging" seconds they have been waiting, so that low priority rows
+// are eventually processed (anti-starvation)
+//
+// Parameters:
+//   - waitingSince (string) : SQL expression of the time since when the row is waiting to be processed
+//
+// Returns:
+//   - string : SQL expression of the effective priority
+func priorityExpression(waitingSince string) string {
+	var aging = config.Settings.Worker.Priority.Aging
+	if aging <= 0 {
+		return "{priority}"
+	}
+	var waited = database.Sql.Greatest(database.Sql.SecondsSince("COALESCE("+waitingSince+", CURRENT_TIMESTAMP)"), "0")
+	return "({priority} + " + database.Sql.IntDiv(waited, strconv.Itoa(aging)) + ")"
+}
+
+// Claims rows from the queue table inside a transaction so that no other cycle or worker dispatches the same rows
+//
+// Rows are locked with "FOR UPDATE SKIP LOCKED" (rows locked by another worker are ignored), or on SQLite the whole
+// database is locked, and flagged as "processing" with the worker identity before the transaction is committed. Only the rows returned by this function may be dispatched.
+// When concurrency groups are configured, their lock rows are held for the whole transaction so that two workers never
+// both see the same free slot.
+//
+// Parameters:
+//   - condition (string) : SQL condition used to select claimable rows
+//   - order (string) : SQL order by clause used to prioritize rows
+//   - owner (string) : Identity of the claiming worker
+//   - limit (int) : Maximum number of rows to claim
+//
+// Returns:
+//   - []types.TblCRQueryQueue : Rows that were successfully claimed by the worker
+//   - error : Set when the claim fails, no rows are claimed then
+func (s sqlStore) claim(condition string, order string, owner string, limit int) ([]types.TblCRQueryQueue, error) {
+	var jobs []types.TblCRQueryQueue
+	// Start transaction
+	tx, err := database.Con.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("cannot start claim transaction on %s table: %v", s.table.Name, err)
+	}
+	// Exclude rows of concurrency groups that have no free slots, claims of other workers wait for this one to commit
+	var usage = map[string]int{}
+	var conditionArgs []interface{}
+	if groups.Enabled() {
+		if err = lockGroups(tx); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		usage, err = groupUsage(tx)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		for group, used := range usage {
+			if used < groups.Limit(group) {
+				continue
+			}
+			for _, pattern := range groups.LikePatterns(group) {
+				condition += " AND {queryName} NOT LIKE ?"
+				conditionArgs = append(conditionArgs, pattern)
+			}
+		}
+	}
+	// Lock claimable rows, skipping the ones already locked by other workers
+	var query = `
+		SELECT
+			{pkQueryQueueID},
+			{querySignature},
+			{queryName},
+			COALESCE({runRepeat}, ''),
+			COALESCE({runTimeout}, 0)
+		FROM {table}
+		WHERE ` + condition + `
+		ORDER BY ` + order + `
+		LIMIT ` + strconv.Itoa(limit) + `
+		` + database.Sql.SkipLocked()
+	results, err := tx.Query(database.Sql.Rebind(s.table.Expand(query)), conditionArgs...)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("cannot select tasks from %s table: %v", s.table.Name, err)
+	}
+	for results.Next() {
+		var row = types.TblCRQueryQueue{}
+		// For each row, scan the result into our tag composite object
+		err = results.Scan(&row.PkQueryQueueID, &row.QuerySignature, &row.QueryName, &row.RunRepeat, &row.RunTimeout)
+		if err != nil {
+			results.Close()
+			tx.Rollback()
+			return nil, fmt.Errorf("cannot scan tasks from %s table: %v", s.table.Name, err)
+		}
+		// Skip rows whose concurrency groups were filled by previous rows of this claim
+		if !acquireGroups(row.QueryName, usage) {
+			log.Writer.Infof("Skipping job #%s, concurrency limit reached for %s", row.QuerySignature, strings.Join(groups.Match(row.QueryName), ", "))
+			continue
+		}
+		jobs = append(jobs, row)
+	}
+	results.Close()
+	// Nothing to claim
+	if len(jobs) <= 0 {
+		tx.Rollback()
+		return jobs, nil
+	}
+	// Flag locked rows as claimed by the worker
+	var placeholders = make([]string, len(jobs))
+	var args = []interface{}{owner, config.Settings.Worker.Lease.Timeout}
+	for i, row := range jobs {
+		placeholders[i] = "?"
+		args = append(args, row.PkQueryQueueID)
+	}
+	query = `
+		UPDATE {table}
+		SET
+			{runStatus} = 'processing',
+			{claimedBy} = ?,
+			{claimedAt} = CURRENT_TIMESTAMP,
+			{leaseExpires} = ` + database.Sql.AddInterval("CURRENT_TIMESTAMP", "SECOND") + `
+		WHERE {pkQueryQueueID} IN (` + strings.Join(placeholders, ",") + `)`
+	_, err = tx.Exec(database.Sql.Rebind(s.table.Expand(query)), args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("cannot claim tasks on %s table: %v", s.table.Name, err)
+	}
+	// Commit claim
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("cannot commit claim on %s table: %v", s.table.Name, err)
+	}
+	return jobs, nil
+}
+
+// Locks the rows of every concurrency group on the group lock table until the claim transaction ends, so that workers
+// count running jobs and claim them one at a time
+//
+// Parameters:
+//   - tx (*sql.Tx) : Claim transaction
+//
+// Returns:
+//   - error : Set when the groups cannot be locked, the transaction must be rolled back by the caller
+func lockGroups(tx *sql.Tx) error {
+	var names = groups.Names()
+	var placeholders = make([]string, len(names))
+	var args = make([]interface{}, len(names))
+	for i, name := range names {
+		placeholders[i] = "(?)"
+		args[i] = name
+	}
+	// Create the missing group rows, locking them in name order
+	var query = `
+		INSERT INTO tblCRQueryQueueGroupLock (groupName)
+		VALUES ` + strings.Join(placeholders, ", ") + `
+		` + database.Sql.Upsert("groupName") + `
+			groupName = ` + database.Sql.Inserted("groupName")
+	if _, err := tx.Exec(database.Sql.Rebind(query), args...); err != nil {
+		return fmt.Errorf("cannot create concurrency group locks: %v", err)
+	}
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	query = `
+		SELECT groupName
+		FROM tblCRQueryQueueGroupLock
+		WHERE groupName IN (` + strings.Join(placeholders, ", ") + `)
+		ORDER BY groupName
+		` + database.Sql.ForUpdate()
+	results, err := tx.Query(database.Sql.Rebind(query), args...)
+	if err != nil {
+		return fmt.Errorf("cannot lock concurrency groups: %v", err)
+	}
+	return results.Close()
+}
+
+// Counts the running jobs ("processing" rows of all workers, on every queue table) of each concurrency group
+//
+// Parameters:
+//   - tx (*sql.Tx) : Claim transaction
+//
+// Returns:
+//   - map[string]int : Number of running jobs per group name
+//   - error : Set when the running jobs cannot be counted, the transaction must be rolled back by the caller
+func groupUsage(tx *sql.Tx) (map[string]int, error) {
+	var usage = map[string]int{}
+	for _, name := range config.QueueNames() {
+		table, err := TableOf(name)
+		if err != nil {
+			return nil, err
+		}
+		var query = `
+			SELECT
+				{queryName},
+				COUNT(*)
+			FROM {table}
+			WHERE {runStatus} = 'processing'
+			GROUP BY {queryName}`
+		results, err := tx.Query(table.Expand(query))
+		if err != nil {
+			return nil, fmt.Errorf("cannot select running tasks from %s table: %v", table.Name, err)
+		}
+		for results.Next() {
+			var queryName string
+			var count int
+			if err = results.Scan(&queryName, &count); err != nil {
+				results.Close()
+				return nil, fmt.Errorf("cannot scan running tasks from %s table: %v", table.Name, err)
+			}
+			for _, group := range groups.Match(queryName) {
+				usage[group] += count
+			}
+		}
+		results.Close()
+		if err = results.Err(); err != nil {
+			return nil, fmt.Errorf("cannot select running tasks from %s table: %v", table.Name, err)
+		}
+	}
+	return usage, nil
+}
+
+// Takes a slot on every concurrency group of a query, only when all of them have one free
+//
+// Parameters:
+//   - queryName (string) : The "queryName" of the job
+//   - usage (map[string]int) : Number of running jobs per group name, updated when slots are taken
+//
+// Returns:
+//   - bool : Weather the slots were taken
+func acquireGroups(queryName string, usage map[string]int) bool {
+	var matches = groups.Match(queryName)
+	for _, group := range matches {
+		if usage[group] >= groups.Limit(group) {
+			return false
+		}
+	}
+	for _, group := range matches {
+		usage[group]++
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"github.com/creasty/defaults"
+	"path/filepath"
+	"query-queue-worker/config"
+	"query-queue-worker/database"
+	"query-queue-worker/engine/groups"
+	"query-queue-worker/log"
+	"query-queue-worker/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+const pastDate = "2000-01-01 00:00:00" // Date stored on "runNext" by insertRow
+
+// Opens a migrated SQLite database on a temporary file and initializes the store of the default queue
+func openDatabase(t *testing.T) {
+	config.Settings = types.AppConfig{}
+	defaults.Set(&config.Settings)
+	config.Settings.Driver = "sqlite"
+	config.Settings.Sqlite.Path = filepath.Join(t.TempDir(), "queue.db")
+	log.Init(&config.Settings, true)
+	database.Load()
+	t.Cleanup(func() {
+		database.Con.Close()
+	})
+	if _, err := database.MigrateUp(0); err != nil {
+		t.Fatalf("MigrateUp returned error: %v", err)
+	}
+	groups.Init()
+	Init()
+}
+
+// Inserts a row on the default queue table
+func insertRow(t *testing.T, signature string, name string, status string, claimedBy string, attempts int) types.TblCRQueryQueue {
+	var owner interface{} = nil
+	if claimedBy != "" {
+		owner = claimedBy
+	}
+	result, err := database.Exec(
+		"INSERT INTO tblCRQueryQueue (querySignature, queryName, runStatus, claimedBy, attempts, runNext) VALUES (?, ?, ?, ?, ?, ?)",
+		signature, name, status, owner, attempts, pastDate,
+	)
+	if err != nil {
+		t.Fatalf("cannot insert row: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return types.TblCRQueryQueue{PkQueryQueueID: int(id), QuerySignature: signature, QueryName: name}
+}
+
+// Queue row state checked by the tests
+type rowState struct {
+	status    string
+	attempts  int
+	runNext   string // pastDate when kept, "future" when scheduled
+	claimedBy string
+}
+
+// Reads the state of a row of the default queue table
+func readRow(t *testing.T, job types.TblCRQueryQueue) rowState {
+	var state rowState
+	var future bool
+	err := database.QueryRow(
+		"SELECT runStatus, attempts, COALESCE(runNext, ''), runNext > CURRENT_TIMESTAMP, COALESCE(claimedBy, '') FROM tblCRQueryQueue WHERE pkQueryQueueID = ?",
+		job.PkQueryQueueID,
+	).Scan(&state.status, &state.attempts, &state.runNext, &future, &state.claimedBy)
+	if err != nil {
+		t.Fatalf("cannot read row: %v", err)
+	}
+	if future {
+		state.runNext = "future"
+	}
+	return state
+}
+
+func TestMarkCompleted(t *testing.T) {
+	openDatabase(t)
+	var nextIn = time.Hour
+	var tests = []struct {
+		name      string
+		status    string
+		claimedBy string
+		runNext   *time.Duration
+		state     rowState
+	}{
+		{"left processing by its command", "processing", "me", nil, rowState{"completed", 0, pastDate, ""}},
+		{"repeating job", "processing", "me", &nextIn, rowState{"completed", 0, "future", ""}},
+		{"completed by its command", "completed", "me", &nextIn, rowState{"completed", 0, "future", ""}},
+		{"failed by its command", "failed", "me", &nextIn, rowState{"failed", 2, pastDate, ""}},
+		{"claimed by another worker", "processing", "other", &nextIn, rowState{"processing", 2, pastDate, "other"}},
+		{"completed by another worker", "completed", "", &nextIn, rowState{"completed", 2, pastDate, ""}},
+	}
+	for _, test := range tests {
+		var job = insertRow(t, test.name, "q", test.status, test.claimedBy, 2)
+		if err := Queue.MarkCompleted(job, "me", test.runNext); err != nil {
+			t.Fatalf("%s: MarkCompleted returned error: %v", test.name, err)
+		}
+		if state := readRow(t, job); state != test.state {
+			t.Errorf("%s: row = %+v, want %+v", test.name, state, test.state)
+		}
+	}
+}
+
+// Runs a statement setting up the rows of a test
+func execute(t *testing.T, query string, args ...interface{}) {
+	if _, err := database.Exec(query, args...); err != nil {
+		t.Fatalf("cannot run %q: %v", query, err)
+	}
+}
+
+// Lists the signatures of claimed rows
+func signatures(jobs []types.TblCRQueryQueue) []string {
+	var list = []string{}
+	for _, job := range jobs {
+		list = append(list, job.QuerySignature)
+	}
+	return list
+}
+
+func TestClaim(t *testing.T) {
+	openDatabase(t)
+	var low = insertRow(t, "low", "q", "pending", "", 0)
+	var high = insertRow(t, "high", "q", "pending", "", 0)
+	var third = insertRow(t, "third", "q", "pending", "", 0)
+	insertRow(t, "running", "q", "processing", "other", 0)
+	insertRow(t, "quarantined", "q", "pending", "", 0)
+	insertRow(t, "elsewhere", "q", "pending", "", 0)
+	var later = insertRow(t, "later", "q", "pending", "", 0)
+	var repeating = insertRow(t, "repeating", "q", "completed", "", 0)
+	insertRow(t, "once", "q", "completed", "", 0)
+	execute(t, "UPDATE tblCRQueryQueue SET priority = 5 WHERE pkQueryQueueID = ?", high.PkQueryQueueID)
+	execute(t, "UPDATE tblCRQueryQueue SET runNext = datetime('now', '+1 hour') WHERE pkQueryQueueID = ?", later.PkQueryQueueID)
+	execute(t, "UPDATE tblCRQueryQueue SET runRepeat = '1h' WHERE pkQueryQueueID = ?", repeating.PkQueryQueueID)
+	execute(t, "INSERT INTO tblCRQueryQueueQuarantine (queueName, querySignature, queryName, processType, quarantinedAt) VALUES (?, 'quarantined', 'q', 'pending', CURRENT_TIMESTAMP)", Queue.Name())
+	execute(t, "INSERT INTO tblCRQueryQueueQuarantine (queueName, querySignature, queryName, processType, quarantinedAt) VALUES ('other', 'elsewhere', 'q', 'pending', CURRENT_TIMESTAMP)")
+	// Highest priority first, then insertion order, up to the limit
+	jobs, err := Queue.ClaimPending("me", 2)
+	if err != nil {
+		t.Fatalf("ClaimPending returned error: %v", err)
+	}
+	if got := strings.Join(signatures(jobs), ","); got != "high,low" {
+		t.Errorf("ClaimPending claimed %s, want high,low", got)
+	}
+	for _, job := range []types.TblCRQueryQueue{high, low} {
+		if state := readRow(t, job); state.status != "processing" || state.claimedBy != "me" {
+			t.Errorf("claimed row %s = %+v, want processing by me", job.QuerySignature, state)
+		}
+	}
+	// Running, quarantined and future rows are left out, quarantines of other queues do not apply
+	jobs, err = Queue.ClaimPending("me", 10)
+	if err != nil {
+		t.Fatalf("ClaimPending returned error: %v", err)
+	}
+	if got := strings.Join(signatures(jobs), ","); got != "third,elsewhere" {
+		t.Errorf("ClaimPending claimed %s, want third,elsewhere", got)
+	}
+	if state := readRow(t, third); state.status != "processing" {
+		t.Errorf("claimed row third = %+v, want processing", state)
+	}
+	// Only completed rows that repeat are updated
+	jobs, err = Queue.ClaimUpdate("me", 10)
+	if err != nil {
+		t.Fatalf("ClaimUpdate returned error: %v", err)
+	}
+	if got := strings.Join(signatures(jobs), ","); got != "repeating" {
+		t.Errorf("ClaimUpdate claimed %s, want repeating", got)
+	}
+	if state := readRow(t, repeating); state.status != "processing" || state.claimedBy != "me" {
+		t.Errorf("claimed row repeating = %+v, want processing by me", state)
+	}
+}
+
+func TestStats(t *testing.T) {
+	openDatabase(t)
+	var adds = []struct {
+		processType string
+		queryName   string
+		count       types.EngineProcessTypeCounts
+		lastError   string
+	}{
+		{"Pending", "", types.EngineProcessTypeCounts{Total: 3, Successful: 2, Failed: 1}, "boom"},
+		{"Pending", "report", types.EngineProcessTypeCounts{Total: 2, Successful: 1, Failed: 1}, "boom"},
+		{"Pending", "export", types.EngineProcessTypeCounts{Total: 1, Successful: 1}, ""},
+		{"Pending", "", types.EngineProcessTypeCounts{Total: 1, Failed: 1, TimedOut: 1}, "timeout"},
+		{"Pending", "export", types.EngineProcessTypeCounts{Total: 1, Failed: 1, TimedOut: 1}, "timeout"},
+	}
+	for _, add := range adds {
+		if err := Queue.AddStats(add.processType, add.queryName, add.count, add.lastError); err != nil {
+			t.Fatalf("AddStats returned error: %v", err)
+		}
+	}
+	processes, err := Queue.LoadStats()
+	if err != nil {
+		t.Fatalf("LoadStats returned error: %v", err)
+	}
+	var pending = processes["Pending"]
+	if pending.Count.Total != 4 || pending.Count.Successful != 2 || pending.Count.Failed != 2 || pending.Count.TimedOut != 1 {
+		t.Errorf("Pending counts = %+v, want the sum of the process type rows", pending.Count)
+	}
+	if pending.LastRun.IsZero() {
+		t.Errorf("Pending last run is not set")
+	}
+	var queries = map[string]types.EngineQueryStats{
+		"report": {LastError: "boom", Total: 2, Successful: 1, Failed: 1},
+		"export": {LastError: "timeout", Total: 2, Successful: 1, Failed: 1, TimedOut: 1},
+	}
+	if len(pending.Queries) != len(queries) {
+		t.Errorf("Pending queries = %+v, want %d query names", pending.Queries, len(queries))
+	}
+	for name, want := range queries {
+		var got = pending.Queries[name]
+		if got.LastRun.IsZero() {
+			t.Errorf("%s last run is not set", name)
+		}
+		got.LastRun = time.Time{}
+		if got != want {
+			t.Errorf("%s statistics = %+v, want %+v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package store persists the queue state: queue rows, quarantine, statistics and run history
+//
+// The engine only goes through the Store interface, the SQL implementation relies on the database dialect of the
+// "driver" setting (MYSQL, PostgreSQL, SQLite) so that the same queries run on every supported server
+package store
+
+import (
+	"errors"
+	"query-queue-worker/config"
+	"query-queue-worker/types"
+	"strings"
+	"time"
+)
+
+// Store reads and updates the queue tables of a queue on behalf of the engine
+//
+// Claimed rows are updated by their primary key, as signatures are not unique on the queue table. Quarantined signatures
+// are kept per queue, while the statistics and the run history are shared by every queue
+type Store interface {
+	// Returns the queue name
+	Name() string
+	// Checks that the queue table exists and holds every queue column
+	CheckTable() error
+	// Counts the rows waiting for a "pending" and an "update" job, along with their highest effective priority
+	Lookup() (pending int, update int, pendingPriority int, updatePriority int, err error)
+	// Claims up to limit rows waiting for a "pending" job for a worker, highest effective priority first
+	ClaimPending(owner string, limit int) ([]types.TblCRQueryQueue, error)
+	// Claims up to limit rows waiting for an "update" job for a worker, highest effective priority first
+	ClaimUpdate(owner string, limit int) ([]types.TblCRQueryQueue, error)
+	// Extends the lease of a row claimed by a worker
+	Heartbeat(job types.TblCRQueryQueue, owner string) error
+	// Returns rows with an expired lease to "pending", failing the ones already recovered maxRecoveries times
+	Recover(maxRecoveries int) (recovered int64, failed int64, err error)
+	// Returns the failed rows with less than maxAttempts attempts, cancelled rows are never retried
+	Retryable(maxAttempts int) ([]types.TblCRQueryQueue, error)
+	// Moves a failed row back to "pending" once delay has elapsed, counting one more attempt
+	Retry(job types.TblCRQueryQueue, delay time.Duration) error
+	// Returns the repeating rows that are not failed
+	Repeating() ([]types.TblCRQueryQueue, error)
+	// Flags a row claimed by a worker as failed and releases its claim
+	MarkFailed(job types.TblCRQueryQueue, owner string, runError string) error
+	// Flags a row claimed by a worker as cancelled and releases its claim, cancelled rows are no longer processed nor retried
+	MarkCancelled(job types.TblCRQueryQueue, owner string, runError string) error
+	// Returns a row claimed by a worker to the status it was claimed from and releases its claim, EG: when the worker stops
+	Requeue(job types.TblCRQueryQueue, owner string, status string) error
+	// Records the outcome of a row claimed by a worker and releases its claim, runNext is nil when no run is scheduled
+	MarkFinished(job types.TblCRQueryQueue, owner string, status string, runError string, runTime time.Duration, runNext *time.Duration) error
+	// Releases the claim of a row completed by its own command, resets its attempts and, when runNext is set, schedules its
+	// next run
+	MarkCompleted(job types.TblCRQueryQueue, owner string, runNext *time.Duration) error
+	// Clears the consecutive failures of a signature
+	ClearFailures(signature string) error
+	// Counts one more consecutive failure of a signature
+	CountFailure(job types.TblCRQueryQueue, processType string, runError string) error
+	// Quarantines a signature that reached the failures threshold, for cooldown seconds (0 until released)
+	Quarantine(signature string, failures int, cooldown int) (bool, error)
+	// Returns the quarantined signatures of every queue, most recent first
+	Quarantined() ([]types.EngineQuarantinedJob, error)
+	// Releases a quarantined signature, returning weather it was quarantined
+	Release(signature string) (bool, error)
+	// Returns the persisted statistics by process type, with the statistics of each query name on Queries
+	LoadStats() (map[string]types.EngineProcessType, error)
+	// Adds statistics to the persisted aggregate of a process type and query name (empty for the process type)
+	AddStats(processType string, queryName string, count types.EngineProcessTypeCounts, lastError string) error
+	// Records a job execution on the run history, under the queue it is given
+	RecordRun(run types.TblCRQueryQueueRun, duration time.Duration) error
+	// Deletes the run history records older than a number of days
+	PurgeRuns(days int) (int64, error)
+}
+
+var Queue Store    // Store of the default queue, used for the tables shared by every queue
+var Queues []Store // Stores of every queue processed by the worker, the default queue first
+
+// Initializes package, once the database connection is loaded
+func Init() {
+	Queues = nil
+	for _, name := range config.QueueNames() {
+		table, _ := TableOf(name)
+		Queues = append(Queues, sqlStore{table: table})
+	}
+	Queue = Queues[0]
+}
+
+// Returns the store of a queue
+//
+// Parameters:
+//   - queue (string) : Queue name, empty for the default queue
+//
+// Returns:
+//   - Store : Store of the queue
+//   - error : Set when the queue is not configured
+func Find(queue string) (Store, error) {
+	if queue == "" {
+		return Queue, nil
+	}
+	for _, store := range Queues {
+		if store.Name() == queue {
+			return store, nil
+		}
+	}
+	return nil, errors.New("unknown queue \"" + queue + "\" (queues: " + strings.Join(config.QueueNames(), ", ") + ")")
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"errors"
+	"query-queue-worker/config"
+	"regexp"
+	"strings"
+)
+
+// Queue table of a queue, along with the names its columns are mapped to ("worker.queues")
+type Table struct {
+	Queue   string            // Queue name
+	Name    string            // Table name
+	Columns map[string]string // Column names by types.TblCRQueryQueue "TbField" tag, missing ones keep their tag name
+}
+
+var token = regexp.MustCompile(`\{(\w+)\}`) // Placeholders expanded by Table.Expand (EG: "{runStatus}")
+
+// Returns the queue table of a queue
+//
+// Parameters:
+//   - queue (string) : Queue name, empty for the default queue
+//
+// Returns:
+//   - Table : Queue table and column names
+//   - error : Set when the queue is not configured
+func TableOf(queue string) (Table, error) {
+	if queue == "" {
+		queue = config.QueueNames()[0]
+	}
+	settings, ok := config.Queues()[queue]
+	if !ok {
+		return Table{}, errors.New("unknown queue \"" + queue + "\" (queues: " + strings.Join(config.QueueNames(), ", ") + ")")
+	}
+	return Table{Queue: queue, Name: settings.Table, Columns: settings.Columns}, nil
+}
+
+// Returns the name of a column on the table
+//
+// Parameters:
+//   - column (string) : The types.TblCRQueryQueue "TbField" tag of the column (EG: "runStatus")
+//
+// Returns:
+//   - string : Column name on the table
+func (t Table) Column(column string) string {
+	if name := t.Columns[column]; name != "" {
+		return name
+	}
+	return column
+}
+
+// Expands the placeholders of a query written for any queue table
+//
+// "{table}" is replaced by the table name, "{queue}" by the queue name as a SQL string and any other "{column}" by the
+// column name on the table. Names are validated by the config as plain identifiers, so they are written as is.
+//
+// Parameters:
+//   - query (string) : Query holding placeholders
+//
+// Returns:
+//   - string : Query on the table
+func (t Table) Expand(query string) string {
+	return token.ReplaceAllStringFunc(query, func(placeholder string) string {
+		var name = placeholder[1 : len(placeholder)-1]
+		switch name {
+		case "table":
+			return t.Name
+		case "queue":
+			return "'" + t.Queue + "'"
+		}
+		return t.Column(name)
+	})
+}
@@ -20,6 +20,7 @@ import (
 var stats = types.EngineThreads{}
 var wg = sync.WaitGroup{}
 var mu = sync.Mutex{}
+var slots = map[string]map[int]bool{} // Thread slots taken per process type
 
 var Type = types.EngineThreadsProcessType{} // Returns the thread process types
 
@@ -38,8 +39,27 @@ func Init() {
 	stats.Maintenance.Max = 0
 }
 
+// Changes the maximum number of threads, running threads over a lowered maximum are left to finish
+//
+// Parameters:
+//   - max (int) : Maximum number of threads, at least 3
+func SetMax(max int) {
+	mu.Lock()
+	defer mu.Unlock()
+	stats.Max = max
+}
+
+// Returns a copy of the current thread statistics
+func GetStats() types.EngineThreads {
+	mu.Lock()
+	defer mu.Unlock()
+	return stats
+}
+
 // Returns the remaining count of available threads to allocate
 func GetAllocationCount() int {
+	mu.Lock()
+	defer mu.Unlock()
 	return stats.Max - stats.Used
 }
 
@@ -48,6 +68,8 @@ func GetAllocationCount() int {
 // Parameters:
 //   - processType string : Reference to the types.EngineThreadsProcessType as string
 func GetUsedCount(processType string) int {
+	mu.Lock()
+	defer mu.Unlock()
 	var available = 0
 	switch processType {
 	case Type.Pending:
@@ -68,6 +90,8 @@ func GetUsedCount(processType string) int {
 // Parameters:
 //   - processType string : Reference to the types.EngineThreadsProcessType as string
 func GetAvailableCount(processType string) int {
+	mu.Lock()
+	defer mu.Unlock()
 	var available = 0
 	switch processType {
 	case Type.Pending:
@@ -86,13 +110,17 @@ func GetAvailableCount(processType string) int {
 	return available
 }
 
-// Allocate thread distribution dependent on current load and processing types
+// Allocate thread distribution dependent on current load, priority and processing types
 //
 // Parameters:
 //   - allocateToPending (int) : How many threads needed to be allocated to pending type jobs
 //   - allocateToUpdate (int) : How many threads needed to be allocated to update type jobs
 //   - allocateToMaintenance (int) : How many threads needed to be allocated to maintenance type jobs
-func Allocate(allocateToPending int, allocateToUpdate int, allocateToMaintenance int) {
+//   - pendingPriority (int) : Highest effective priority among pending type jobs
+//   - updatePriority (int) : Highest effective priority among update type jobs
+func Allocate(allocateToPending int, allocateToUpdate int, allocateToMaintenance int, pendingPriority int, updatePriority int) {
+	mu.Lock()
+	defer mu.Unlock()
 	var totalAvailable = stats.Max - stats.Used
 	// Check if we can proceed with allocation
 	if totalAvailable < 1 {
@@ -114,6 +142,19 @@ func Allocate(allocateToPending int, allocateToUpdate int, allocateToMaintenance
 		stats.Update.Max = stats.Update.Used + allocateToUpdate
 		return
 	}
+	// If both types have demand and one of them holds higher priority jobs, then serve it first while keeping one thread for the other
+	if allocateToPending > 0 && allocateToUpdate > 0 && pendingPriority != updatePriority && totalAvailable > 1 {
+		if pendingPriority > updatePriority {
+			var toPending = min(allocateToPending, totalAvailable-1)
+			stats.Pending.Max = stats.Pending.Used + toPending
+			stats.Update.Max = stats.Update.Used + (totalAvailable - toPending)
+		} else {
+			var toUpdate = min(allocateToUpdate, totalAvailable-1)
+			stats.Update.Max = stats.Update.Used + toUpdate
+			stats.Pending.Max = stats.Pending.Used + (totalAvailable - toUpdate)
+		}
+		return
+	}
 	// If we cant accommodate all allocations, then try to distribute with 50% each
 	if allocateToPending > 0 {
 		// For Pending: we want to focus our main allocation on pending
@@ -126,11 +167,22 @@ func Allocate(allocateToPending int, allocateToUpdate int, allocateToMaintenance
 	}
 }
 
+// Returns the lowest of two integers
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 // Add thread count
 //
 // Parameters:
 //   - processType string : Reference to the types.EngineThreadsProcessType as string
-func Add(processType string) {
+//
+// Returns:
+//   - int : Slot of the process type taken by the thread, the lowest free one starting at 1, identifying it on logs
+func Add(processType string) int {
 	// Lock sync
 	mu.Lock()
 	// Add to the pool and threadCount
@@ -150,15 +202,26 @@ func Add(processType string) {
 		stats.Used++
 		break
 	}
+	// Take the lowest free slot
+	if slots[processType] == nil {
+		slots[processType] = map[int]bool{}
+	}
+	var slot = 1
+	for slots[processType][slot] {
+		slot++
+	}
+	slots[processType][slot] = true
 	// Unlock sync
 	mu.Unlock()
+	return slot
 }
 
 // Remove thread count
 //
 // Parameters:
 //   - processType string : Reference to the types.EngineThreadsProcessType as string
-func Remove(processType string) {
+//   - slot int : Slot returned by Add when the thread was added
+func Remove(processType string, slot int) {
 	// Lock sync
 	mu.Lock()
 	// Remove from pool and threadCount
@@ -178,15 +241,20 @@ func Remove(processType string) {
 		stats.Used--
 		break
 	}
+	// Free its slot
+	delete(slots[processType], slot)
 	// Unlock sync
 	mu.Unlock()
 }
 
-// Wait for WorkGroup threads to finish
+// Wait for WorkGroup threads to finish, jobs that are not waited for must be stopped by the caller first
 func Wait() {
-	// Wait for threads to finish
-	if config.Settings.Threads.WaitToFinish && stats.Used >= 1 {
-		log.Printf("Waiting for %d threads to finish...", stats.Used)
+	// Wait for threads to finish, the lock is released first so that finishing threads can remove themselves
+	mu.Lock()
+	var used = stats.Used
+	mu.Unlock()
+	if used >= 1 {
+		log.Printf("Waiting for %d threads to finish...", used)
 		wg.Wait()
 	}
 }
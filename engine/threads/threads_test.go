@@ -0,0 +1,120 @@
+package threads
+
+import (
+	"github.com/creasty/defaults"
+	"query-queue-worker/types"
+	"sync"
+	"testing"
+)
+
+// Runs engine cycles while the statistics are scraped and the maximum is reloaded, as the metrics and admin API do
+func TestConcurrentScrape(t *testing.T) {
+	defaults.Set(&Type)
+	stats = types.EngineThreads{Max: 10}
+	var stop = make(chan bool)
+	var scraped = make(chan bool)
+	go func() {
+		defer close(scraped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				GetStats()
+				SetMax(10)
+			}
+		}
+	}()
+	for cycle := 0; cycle < 200; cycle++ {
+		if GetAllocationCount() <= 0 {
+			continue
+		}
+		Allocate(4, 4, 1, 0, 0)
+		var jobs sync.WaitGroup
+		for _, processType := range []string{Type.Pending, Type.Update, Type.Maintenance} {
+			for i := GetAvailableCount(processType); i > 0; i-- {
+				var slot = Add(processType)
+				jobs.Add(1)
+				go func(processType string, slot int) {
+					defer jobs.Done()
+					GetUsedCount(processType)
+					Remove(processType, slot)
+				}(processType, slot)
+			}
+		}
+		jobs.Wait()
+	}
+	close(stop)
+	<-scraped
+	Wait()
+	if used := GetStats().Used; used != 0 {
+		t.Errorf("GetStats().Used = %d after every thread finished, want 0", used)
+	}
+}
+
+func TestAddSlots(t *testing.T) {
+	defaults.Set(&Type)
+	stats = types.EngineThreads{Max: 10}
+	var steps = []struct {
+		add         string // Process type of the added thread, empty to remove one
+		remove      int    // Slot of the removed pending thread
+		wantSlot    int    // Slot the added thread takes
+		description string
+	}{
+		{Type.Pending, 0, 1, "first pending thread"},
+		{Type.Pending, 0, 2, "second pending thread"},
+		{Type.Pending, 0, 3, "third pending thread"},
+		{Type.Update, 0, 1, "slots are counted per process type"},
+		{"", 2, 0, "remove the second pending thread"},
+		{Type.Pending, 0, 2, "freed slot is taken again"},
+		{Type.Pending, 0, 4, "next slot once the freed one is taken"},
+	}
+	for _, step := range steps {
+		if step.add == "" {
+			Remove(Type.Pending, step.remove)
+			continue
+		}
+		if slot := Add(step.add); slot != step.wantSlot {
+			t.Errorf("%s: Add(%q) = %d, want %d", step.description, step.add, slot, step.wantSlot)
+		}
+	}
+	for _, slot := range []int{1, 2, 3, 4} {
+		Remove(Type.Pending, slot)
+	}
+	Remove(Type.Update, 1)
+	if used := GetStats().Used; used != 0 {
+		t.Errorf("GetStats().Used = %d after every thread was removed, want 0", used)
+	}
+}
+
+func TestAllocatePriority(t *testing.T) {
+	var tests = []struct {
+		description     string
+		running         int // Threads already used by pending jobs and by update jobs each
+		pending         int
+		update          int
+		maintenance     int
+		pendingPriority int
+		updatePriority  int
+		pendingMax      int
+		updateMax       int
+	}{
+		{"demand fits", 0, 3, 4, 0, 9, 0, 3, 4},
+		{"pending first, one thread kept for update", 0, 20, 20, 0, 5, 0, 9, 1},
+		{"update first, one thread kept for pending", 0, 20, 20, 0, 0, 5, 1, 9},
+		{"leftover of the served type goes to the other", 0, 3, 20, 0, 5, 0, 3, 7},
+		{"maintenance takes a thread first", 0, 20, 20, 1, 5, 0, 8, 1},
+		{"running threads are kept", 2, 20, 20, 0, 0, 5, 3, 7},
+		{"same priority is split in half", 0, 20, 20, 0, 5, 5, 5, 0},
+	}
+	defaults.Set(&Type)
+	for _, test := range tests {
+		stats = types.EngineThreads{Max: 10, Used: test.running * 2}
+		stats.Pending.Used = test.running
+		stats.Update.Used = test.running
+		Allocate(test.pending, test.update, test.maintenance, test.pendingPriority, test.updatePriority)
+		if stats.Pending.Max != test.pendingMax || stats.Update.Max != test.updateMax {
+			t.Errorf("%s: pending max = %d and update max = %d, want %d and %d", test.description, stats.Pending.Max, stats.Update.Max, test.pendingMax, test.updateMax)
+		}
+	}
+}
@@ -6,5 +6,8 @@ require (
 	github.com/antigloss/go v1.18.1
 	github.com/creasty/defaults v1.6.0
 	github.com/go-sql-driver/mysql v1.6.0
+	github.com/lib/pq v1.10.9
 	github.com/olekukonko/tablewriter v0.0.5
+	github.com/robfig/cron/v3 v3.0.1
+	modernc.org/sqlite v1.17.3
 )
@@ -6,11 +6,16 @@ import (
 	"os/exec"
 	"query-queue-worker/engine/stats"
 	"strings"
+	"sync"
 )
 
 // Flag that indicates if keypressing handler routine should be shutdown
 var stop = false
 
+// Channel closed once shutdown is requested
+var done = make(chan bool)
+var once = sync.Once{}
+
 // Initializes package
 func Init() {
 	// Create a routine that constantly checks for key inputs
@@ -32,10 +37,16 @@ func IsShuttingDown() bool {
 	return stop
 }
 
+// Returns a channel that is closed once the "Q" (quit) key has been pressed, other libs can block on it until shutdown
+func ShuttingDown() <-chan bool {
+	return done
+}
+
 // Set shutdown flag which will stop go routine to check for key pressings and reset terminal
 func Shutdown() {
 	// Set stopping flag
 	stop = true
+	once.Do(func() { close(done) })
 	// Restore terminal settings
 	exec.Command("stty", "-F", "/dev/tty", "sane").Run()
 }
@@ -2,8 +2,10 @@
 package log
 
 import (
+	"errors"
 	"github.com/antigloss/go/logger"
 	"query-queue-worker/types"
+	"strings"
 )
 
 var Writer *logger.Logger
@@ -24,16 +26,58 @@ func Init(settings *types.AppConfig, silent bool) {
 			destination = logger.LogDestFile
 		}
 	}
+	level, err := ParseLevel(settings.Logs.Level)
+	if err != nil {
+		level = logger.LogLevelInfo
+	}
 	//if config.Settings.Logs.Enabled {
 	logger, _ := logger.New(&logger.Config{
 		LogDir:          settings.Logs.Path,
 		LogFileMaxSize:  settings.Logs.MaxSize,
 		LogFileMaxNum:   settings.Logs.MaxCount,
 		LogFileNumToDel: 1,
-		LogLevel:        logger.LogLevelInfo,
+		LogLevel:        level,
 		LogDest:         destination,
 		Flag:            logger.ControlFlagLogLineNum,
 	})
 	// Assign writer variable
 	Writer = logger
 }
+
+// Changes the minimum level of the messages written
+//
+// Parameters:
+//   - level (string) : Level name (trace, info, warn, error)
+//
+// Returns:
+//   - error : Set when the level is unknown
+func SetLevel(level string) error {
+	logLevel, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	Writer.SetLogLevel(logLevel)
+	return nil
+}
+
+// Maps a level name to its logger level
+//
+// Parameters:
+//   - level (string) : Level name (trace, info, warn, error)
+//
+// Returns:
+//   - logger.LogLevel : Logger level
+//   - error : Set when the level is unknown
+func ParseLevel(level string) (logger.LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "trace":
+		return logger.LogLevelTrace, nil
+	case "info":
+		return logger.LogLevelInfo, nil
+	case "warn":
+		return logger.LogLevelWarn, nil
+	case "error":
+		return logger.LogLevelError, nil
+	}
+	return logger.LogLevelInfo, errors.New("must be one of trace, info, warn or error")
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"flag"
+	"query-queue-worker/api"
+	"query-queue-worker/cli"
 	"query-queue-worker/config"
 	"query-queue-worker/database"
 	"query-queue-worker/engine"
+	"query-queue-worker/engine/store"
+	"query-queue-worker/engine/threads"
 	"query-queue-worker/keys"
 	"query-queue-worker/log"
+	"query-queue-worker/metrics"
 	"query-queue-worker/os"
 )
 
@@ -14,28 +19,69 @@ import (
 func main() {
 	/**************** ARGS ****************/
 	var silentMode = flag.Bool("silent", false, "Weather to display stdout")
+	var configPath = flag.String("config", "query-queue-config.json", "Location of the JSON config file")
+	config.RegisterFlags(flag.CommandLine)
+	flag.Usage = cli.Usage
 	flag.Parse()
+	var command = "run"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+	var configGiven = false
+	flag.Visit(func(given *flag.Flag) {
+		configGiven = configGiven || given.Name == "config"
+	})
+	config.SetPath(*configPath, configGiven)
+	// Check config without loading it, so that every problem is reported instead of exiting
+	if command == "config" {
+		cli.Run(command, flag.Args()[1:])
+		return
+	}
 	/**************** INIT ****************/
 	// Load config
 	config.Init()
 	// Load log
 	log.Init(&config.Settings, *silentMode)
-	// Load MYSQL
+	// Load database (MYSQL, PostgreSQL or SQLite) and its queue store
 	database.Load()
+	store.Init()
+	/**************** COMMANDS ****************/
+	// Run queue management commands instead of the worker
+	if command != "run" {
+		cli.Run(command, flag.Args()[1:])
+		return
+	}
 	// Init OS package (handle OS sigterms)
 	os.Init()
 	// Init keys package (handle keyboard bindings)
 	keys.Init()
 	// Init engine
 	engine.Init()
+	// Init metrics (serve engine statistics over HTTP)
+	metrics.Init()
+	// Init admin API (inspect and control the worker over HTTP)
+	api.Init()
 	/**************** BANNER ****************/
 	log.Writer.Infof("Query-Queue-Worker : V0.1")
+	log.Writer.Info("Effective config: " + config.Redacted())
 	/**************** START ****************/
 	// Start worker engine (start processing)
 	engine.Start()
-	// Start app
-	for keys.IsShuttingDown() == false && os.IsShuttingDown() == false {
-		// Endless loop until OS signal or user input to Quit
+	// Watch config file for changes (when enabled)
+	config.Watch()
+	// Start app: reload config on request, block until OS signal or user input to Quit
+	var running = true
+	for running {
+		select {
+		case <-os.Reloading():
+			reload()
+		case <-config.Changed():
+			reload()
+		case <-keys.ShuttingDown():
+			running = false
+		case <-os.ShuttingDown():
+			running = false
+		}
 	}
 	/**************** SHUTDOWN ****************/
 	// Stop keys
@@ -43,3 +89,27 @@ func main() {
 	// Stop engine
 	engine.Stop()
 }
+
+// Reloads the config file and applies the settings that can change while running, the current settings are kept on error
+func reload() {
+	log.Writer.Info("Reloading config")
+	changes, restart, err := config.Reload()
+	if err != nil {
+		log.Writer.Errorf("Cannot reload config, keeping current settings: %v", err.Error())
+		return
+	}
+	for _, change := range changes {
+		log.Writer.Info("Config changed " + change)
+	}
+	if len(changes) == 0 {
+		log.Writer.Info("No config changes to apply")
+	}
+	if restart {
+		log.Writer.Warn("Config holds changes that are only applied on restart")
+	}
+	// Apply settings held outside of the config
+	threads.SetMax(config.Current().Threads.Max)
+	log.SetLevel(config.Current().Logs.Level)
+	// Run a cycle right away so that the new idle time and thread count are used
+	engine.Wake()
+}
@@ -0,0 +1,270 @@
+// Package metrics records engine statistics and exposes them on an HTTP listener using the Prometheus text format
+//
+// Exposed metrics:
+//   - Jobs started, succeeded, failed and timed out per process type and query name
+//   - Job duration histogram per process type and query name
+//   - Thread slots used and allocated per process type, and the maximum thread count
+//   - Lookup duration histogram and backlog size per process type
+//   - Database errors per operation and weather the engine is degraded (database unreachable)
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"query-queue-worker/config"
+	"query-queue-worker/engine/threads"
+	"query-queue-worker/log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric with a value per label set
+type vector struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]float64
+}
+
+// Histogram with an observation distribution per label set
+type histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+var mu = sync.Mutex{}
+
+var jobsStarted = newVector("qqw_jobs_started_total", "Jobs started per process type and query name.", "counter", "type", "query")
+var jobsSucceeded = newVector("qqw_jobs_succeeded_total", "Jobs finished successfully per process type and query name.", "counter", "type", "query")
+var jobsFailed = newVector("qqw_jobs_failed_total", "Jobs failed per process type and query name (timed out jobs included).", "counter", "type", "query")
+var jobsTimedOut = newVector("qqw_jobs_timed_out_total", "Jobs killed for exceeding their timeout per process type and query name.", "counter", "type", "query")
+var backlog = newVector("qqw_backlog_jobs", "Jobs waiting to be processed per process type, as seen on the last lookup.", "gauge", "type")
+var degraded = newVector("qqw_engine_degraded", "Weather the engine is skipping cycles because the database is unreachable (1) or not (0).", "gauge")
+var databaseErrors = newVector("qqw_database_errors_total", "Database errors per operation.", "counter", "operation")
+var jobDuration = newHistogram("qqw_job_duration_seconds", "Job duration per process type and query name.", []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600}, "type", "query")
+var lookupDuration = newHistogram("qqw_lookup_duration_seconds", "Duration of the database lookup for pending jobs.", []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5})
+
+// Initializes package, starting the HTTP listener when metrics are enabled
+func Init() {
+	if !config.Settings.Metrics.Enabled {
+		return
+	}
+	degraded.set(0)
+	var mux = http.NewServeMux()
+	mux.HandleFunc(config.Settings.Metrics.Path, handle)
+	go func() {
+		log.Writer.Infof("Serving metrics on %s%s", config.Settings.Metrics.Address, config.Settings.Metrics.Path)
+		err := http.ListenAndServe(config.Settings.Metrics.Address, mux)
+		if err != nil {
+			log.Writer.Errorf("Metrics listener stopped: %v", err.Error())
+		}
+	}()
+}
+
+// Records the start of a job
+//
+// Parameters:
+//   - processType (string) : Reference to the types.EngineThreadsProcessType as string
+//   - queryName (string) : The "queryName" of the job
+func JobStarted(processType string, queryName string) {
+	mu.Lock()
+	defer mu.Unlock()
+	jobsStarted.add(1, processType, queryName)
+}
+
+// Records the outcome of a job
+//
+// Parameters:
+//   - processType (string) : Reference to the types.EngineThreadsProcessType as string
+//   - queryName (string) : The "queryName" of the job
+//   - successful (bool) : Weather the job command succeeded
+//   - timedOut (bool) : Weather the job was killed for exceeding its timeout
+//   - duration (time.Duration) : Wall time taken by the job command
+func JobFinished(processType string, queryName string, successful bool, timedOut bool, duration time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	if successful {
+		jobsSucceeded.add(1, processType, queryName)
+	} else {
+		jobsFailed.add(1, processType, queryName)
+	}
+	if timedOut {
+		jobsTimedOut.add(1, processType, queryName)
+	}
+	jobDuration.observe(duration.Seconds(), processType, queryName)
+}
+
+// Records a lookup for pending jobs
+//
+// Parameters:
+//   - duration (time.Duration) : Time taken by the lookup query
+//   - pending (int) : Number of jobs waiting for a "pending" thread
+//   - update (int) : Number of jobs waiting for an "update" thread
+func LookupFinished(duration time.Duration, pending int, update int) {
+	mu.Lock()
+	defer mu.Unlock()
+	lookupDuration.observe(duration.Seconds())
+	backlog.set(float64(pending), threads.Type.Pending)
+	backlog.set(float64(update), threads.Type.Update)
+}
+
+// Records a database error
+//
+// Parameters:
+//   - operation (string) : Short name of the failed operation (EG: "claim", "heartbeat")
+func DatabaseError(operation string) {
+	mu.Lock()
+	defer mu.Unlock()
+	databaseErrors.add(1, operation)
+}
+
+// Records weather the engine is degraded (skipping cycles because the database is unreachable)
+//
+// Parameters:
+//   - isDegraded (bool) : Weather the engine is degraded
+func SetDegraded(isDegraded bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	var value = 0.0
+	if isDegraded {
+		value = 1
+	}
+	degraded.set(value)
+}
+
+// Writes all metrics in the Prometheus text format
+func handle(w http.ResponseWriter, r *http.Request) {
+	var out strings.Builder
+	// Thread gauges are read at scrape time
+	var stats = threads.GetStats()
+	var used = newVector("qqw_threads_used", "Thread slots in use per process type.", "gauge", "type")
+	var allocated = newVector("qqw_threads_allocated", "Thread slots allocated per process type.", "gauge", "type")
+	used.set(float64(stats.Pending.Used), threads.Type.Pending)
+	used.set(float64(stats.Update.Used), threads.Type.Update)
+	used.set(float64(stats.Maintenance.Used), threads.Type.Maintenance)
+	allocated.set(float64(stats.Pending.Max), threads.Type.Pending)
+	allocated.set(float64(stats.Update.Max), threads.Type.Update)
+	allocated.set(float64(stats.Maintenance.Max), threads.Type.Maintenance)
+	var max = newVector("qqw_threads_max", "Maximum number of concurrent jobs.", "gauge")
+	max.set(float64(stats.Max))
+	used.write(&out)
+	allocated.write(&out)
+	max.write(&out)
+	// Recorded metrics
+	mu.Lock()
+	for _, v := range []*vector{jobsStarted, jobsSucceeded, jobsFailed, jobsTimedOut, backlog, degraded, databaseErrors} {
+		v.write(&out)
+	}
+	jobDuration.write(&out)
+	lookupDuration.write(&out)
+	mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, out.String())
+}
+
+// Creates a new metric vector
+func newVector(name string, help string, kind string, labels ...string) *vector {
+	return &vector{name: name, help: help, kind: kind, labels: labels, values: map[string]float64{}}
+}
+
+// Adds a value to the metric of a label set
+func (v *vector) add(value float64, labelValues ...string) {
+	v.values[formatLabels(v.labels, labelValues)] += value
+}
+
+// Sets the metric value of a label set
+func (v *vector) set(value float64, labelValues ...string) {
+	v.values[formatLabels(v.labels, labelValues)] = value
+}
+
+// Writes the metric on the Prometheus text format
+func (v *vector) write(out *strings.Builder) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	for _, labels := range sortedKeys(v.values) {
+		fmt.Fprintf(out, "%s%s %v\n", v.name, labels, v.values[labels])
+	}
+}
+
+// Creates a new histogram
+func newHistogram(name string, help string, buckets []float64, labels ...string) *histogram {
+	return &histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		counts:  map[string][]uint64{},
+		sums:    map[string]float64{},
+		totals:  map[string]uint64{},
+	}
+}
+
+// Records an observation for a label set
+func (h *histogram) observe(value float64, labelValues ...string) {
+	var key = strings.Join(labelValues, "\xff")
+	if _, ok := h.counts[key]; !ok {
+		h.counts[key] = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[key][i]++
+		}
+	}
+	h.sums[key] += value
+	h.totals[key]++
+}
+
+// Writes the histogram on the Prometheus text format
+func (h *histogram) write(out *strings.Builder) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	var keys = make([]string, 0, len(h.counts))
+	for key := range h.counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var bucketLabels = append(append([]string{}, h.labels...), "le")
+	for _, key := range keys {
+		var labelValues []string
+		if len(h.labels) > 0 {
+			labelValues = strings.Split(key, "\xff")
+		}
+		for i, bound := range h.buckets {
+			var labels = formatLabels(bucketLabels, append(append([]string{}, labelValues...), fmt.Sprint(bound)))
+			fmt.Fprintf(out, "%s_bucket%s %d\n", h.name, labels, h.counts[key][i])
+		}
+		var labels = formatLabels(bucketLabels, append(append([]string{}, labelValues...), "+Inf"))
+		fmt.Fprintf(out, "%s_bucket%s %d\n", h.name, labels, h.totals[key])
+		fmt.Fprintf(out, "%s_sum%s %v\n", h.name, formatLabels(h.labels, labelValues), h.sums[key])
+		fmt.Fprintf(out, "%s_count%s %d\n", h.name, formatLabels(h.labels, labelValues), h.totals[key])
+	}
+}
+
+// Formats a label set as "{name="value",...}", escaping values
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	var pairs = make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Returns the keys of a map sorted
+func sortedKeys(values map[string]float64) []string {
+	var keys = make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -4,12 +4,20 @@ package os
 import (
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 )
 
 // Flag that indicates if a signal as been received by the OS
 var stop = false
 
+// Channel closed once a shutdown signal has been received
+var done = make(chan bool)
+var once = sync.Once{}
+
+// Channel notified when a configuration reload is requested (SIGHUP)
+var reload = make(chan bool, 1)
+
 // Initializes package
 func Init() {
 	// Bind OS signals
@@ -21,10 +29,21 @@ func IsShuttingDown() bool {
 	return stop
 }
 
+// Returns a channel that is closed once the OS requests a shutdown, other libs can block on it until shutdown
+func ShuttingDown() <-chan bool {
+	return done
+}
+
+// Returns a channel notified when the OS requests a configuration reload
+func Reloading() <-chan bool {
+	return reload
+}
+
 // Set shutdown flag which will stop go routine to check for OS signals
 func Shutdown() {
 	// Set shutdown flag
 	stop = true
+	once.Do(func() { close(done) })
 }
 
 // Intercepts OS shutdown signals in order to attempt to stop engine gracefully
@@ -38,6 +57,10 @@ func handleOSSignals() {
 			case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
 				Shutdown()
 			case syscall.SIGHUP:
+				select {
+				case reload <- true:
+				default:
+				}
 			case syscall.SIGSEGV:
 			default:
 				return
@@ -6,11 +6,34 @@ import "time"
 /************ AppConfig ************/
 
 type AppConfig struct {
-	Debug   bool             `json:"debug"`
-	Logs    AppConfigLogs    `json:"logs"`
-	Threads AppConfigThreads `json:"threads"`
-	Mysql   AppConfigMysql   `json:"mysql"`
-	Worker  AppConfigWorker  `json:"worker"`
+	Debug    bool              `json:"debug"`
+	Logs     AppConfigLogs     `json:"logs"`
+	Threads  AppConfigThreads  `json:"threads"`
+	Driver   string            `json:"driver" default:"mysql"`
+	Mysql    AppConfigMysql    `json:"mysql"`
+	Postgres AppConfigPostgres `json:"postgres"`
+	Sqlite   AppConfigSqlite   `json:"sqlite"`
+	Worker   AppConfigWorker   `json:"worker"`
+	Metrics  AppConfigMetrics  `json:"metrics"`
+	Api      AppConfigApi      `json:"api"`
+	Reload   AppConfigReload   `json:"reload"`
+}
+
+type AppConfigReload struct {
+	Watch    bool `json:"watch"`
+	Interval int  `json:"interval" default:"5"`
+}
+
+type AppConfigApi struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address" default:"127.0.0.1:9091"`
+	Token   string `json:"token" secret:"true"`
+}
+
+type AppConfigMetrics struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address" default:":9090"`
+	Path    string `json:"path" default:"/metrics"`
 }
 
 type AppConfigLogs struct {
@@ -18,21 +41,147 @@ type AppConfigLogs struct {
 	Path     string `json:"path"`
 	MaxSize  uint32 `json:"maxSize"`
 	MaxCount int    `json:"maxCount"`
+	Level    string `json:"level" default:"info"`
 }
 
 type AppConfigMysql struct {
-	Hostname string `json:"hostname"`
-	Port     string `json:"port"`
-	Database string `json:"database"`
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Hostname     string                 `json:"hostname"`
+	Port         string                 `json:"port"`
+	Socket       string                 `json:"socket"`
+	Database     string                 `json:"database"`
+	Username     string                 `json:"username"`
+	Password     string                 `json:"password" secret:"true"`
+	Tls          AppConfigMysqlTls      `json:"tls"`
+	Timeout      int                    `json:"timeout" default:"10"`
+	ReadTimeout  int                    `json:"readTimeout" default:"0"`
+	WriteTimeout int                    `json:"writeTimeout" default:"0"`
+	ParseTime    bool                   `json:"parseTime"`
+	Loc          string                 `json:"loc" default:"UTC"`
+	Charset      string                 `json:"charset"`
+	Params       map[string]string      `json:"params"`
+	Pool         AppConfigDatabasePool  `json:"pool"`
+	Retry        AppConfigDatabaseRetry `json:"retry"`
+}
+
+type AppConfigMysqlTls struct {
+	Enabled    bool   `json:"enabled"`
+	Ca         string `json:"ca"`
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	ServerName string `json:"serverName"`
+	SkipVerify bool   `json:"skipVerify"`
+}
+
+type AppConfigPostgres struct {
+	Hostname    string                 `json:"hostname"`
+	Port        string                 `json:"port" default:"5432"`
+	Socket      string                 `json:"socket"`
+	Database    string                 `json:"database"`
+	Username    string                 `json:"username"`
+	Password    string                 `json:"password" secret:"true"`
+	SslMode     string                 `json:"sslMode" default:"disable"`
+	SslRootCert string                 `json:"sslRootCert"`
+	SslCert     string                 `json:"sslCert"`
+	SslKey      string                 `json:"sslKey"`
+	Timeout     int                    `json:"timeout" default:"10"`
+	Params      map[string]string      `json:"params"`
+	Pool        AppConfigDatabasePool  `json:"pool"`
+	Retry       AppConfigDatabaseRetry `json:"retry"`
+}
+
+type AppConfigSqlite struct {
+	Path        string                 `json:"path" default:"query-queue.db"`
+	BusyTimeout int                    `json:"busyTimeout" default:"5000"`
+	JournalMode string                 `json:"journalMode" default:"WAL"`
+	Pool        AppConfigDatabasePool  `json:"pool"`
+	Retry       AppConfigDatabaseRetry `json:"retry"`
+}
+
+type AppConfigDatabasePool struct {
+	MaxOpenConns    int `json:"maxOpenConns" default:"0"`
+	MaxIdleConns    int `json:"maxIdleConns" default:"2"`
+	ConnMaxLifetime int `json:"connMaxLifetime" default:"180"`
+	ConnMaxIdleTime int `json:"connMaxIdleTime" default:"60"`
+}
+
+type AppConfigDatabaseRetry struct {
+	Attempts int `json:"attempts" default:"10"`
+	Delay    int `json:"delay" default:"1"`
+	MaxDelay int `json:"maxDelay" default:"60"`
 }
 
 type AppConfigWorker struct {
-	Idle       int                      `json:"idle"`
-	Executable string                   `json:"executable"`
-	Commands   AppConfigWorkerCommands  `json:"commands"`
-	Processes  AppConfigWorkerProcesses `json:"processes"`
+	Id          string                          `json:"id"`
+	Idle        int                             `json:"idle"`
+	Timeout     int                             `json:"timeout"`
+	Managed     bool                            `json:"managed"`
+	Timezone    string                          `json:"timezone"`
+	Executable  string                          `json:"executable"`
+	Lease       AppConfigWorkerLease            `json:"lease"`
+	Retry       AppConfigWorkerRetry            `json:"retry"`
+	Priority    AppConfigWorkerPriority         `json:"priority"`
+	Concurrency AppConfigWorkerConcurrency      `json:"concurrency"`
+	History     AppConfigWorkerHistory          `json:"history"`
+	Stats       AppConfigWorkerStats            `json:"stats"`
+	Quarantine  AppConfigWorkerQuarantine       `json:"quarantine"`
+	Commands    AppConfigWorkerCommands         `json:"commands"`
+	Processes   AppConfigWorkerProcesses        `json:"processes"`
+	Queues      map[string]AppConfigWorkerQueue `json:"queues"`
+}
+
+type AppConfigWorkerLease struct {
+	Timeout       int `json:"timeout" default:"300"`
+	Heartbeat     int `json:"heartbeat" default:"60"`
+	MaxRecoveries int `json:"maxRecoveries" default:"3"`
+}
+
+type AppConfigWorkerStats struct {
+	Flush int `json:"flush" default:"60"`
+}
+
+type AppConfigWorkerQuarantine struct {
+	Failures int `json:"failures" default:"0"`
+	Cooldown int `json:"cooldown" default:"3600"`
+}
+
+type AppConfigWorkerHistory struct {
+	Enabled      bool `json:"enabled" default:"true"`
+	Retention    int  `json:"retention" default:"30"`
+	OutputLength int  `json:"outputLength" default:"4000"`
+}
+
+type AppConfigWorkerConcurrency struct {
+	Groups map[string]AppConfigWorkerConcurrencyGroup `json:"groups"`
+}
+
+type AppConfigWorkerConcurrencyGroup struct {
+	Limit   int      `json:"limit"`
+	Queries []string `json:"queries"`
+}
+
+type AppConfigWorkerPriority struct {
+	Aging int `json:"aging" default:"600"`
+}
+
+type AppConfigWorkerRetry struct {
+	Default AppConfigWorkerRetryPolicy              `json:"default"`
+	Queries map[string]AppConfigWorkerRetryOverride `json:"queries"`
+}
+
+type AppConfigWorkerRetryPolicy struct {
+	MaxAttempts int     `json:"maxAttempts" default:"0"`
+	Delay       int     `json:"delay" default:"60"`
+	Multiplier  float64 `json:"multiplier" default:"2"`
+	Jitter      float64 `json:"jitter" default:"0.1"`
+	MaxDelay    int     `json:"maxDelay" default:"3600"`
+}
+
+type AppConfigWorkerRetryOverride struct {
+	MaxAttempts *int     `json:"maxAttempts"`
+	Delay       *int     `json:"delay"`
+	Multiplier  *float64 `json:"multiplier"`
+	Jitter      *float64 `json:"jitter"`
+	MaxDelay    *int     `json:"maxDelay"`
 }
 
 type AppConfigWorkerCommands struct {
@@ -41,12 +190,30 @@ type AppConfigWorkerCommands struct {
 	Maintenance string `json:"maintenance"`
 }
 
+type AppConfigWorkerQueue struct {
+	Table    string                       `json:"table"`
+	Columns  map[string]string            `json:"columns"`
+	Commands AppConfigWorkerQueueCommands `json:"commands"`
+}
+
+type AppConfigWorkerQueueCommands struct {
+	Single string `json:"single"`
+	Update string `json:"update"`
+}
+
 type AppConfigWorkerProcesses struct {
+	Pending     AppConfigWorkerProcessesJob         `json:"pending"`
+	Update      AppConfigWorkerProcessesJob         `json:"update"`
 	Maintenance AppConfigWorkerProcessesMaintenance `json:"maintenance"`
 }
 
+type AppConfigWorkerProcessesJob struct {
+	Timeout int `json:"timeout"`
+}
+
 type AppConfigWorkerProcessesMaintenance struct {
-	Idle int `json:"idle"`
+	Idle    int `json:"idle"`
+	Timeout int `json:"timeout"`
 }
 
 type AppConfigThreads struct {
@@ -57,38 +224,72 @@ type AppConfigThreads struct {
 /************ Engine ************/
 
 type Engine struct {
-	Status    string `default:"stopped"`
-	Cycles    int    `default:"-1"`
-	Processes EngineProcesses
+	Id        string          `json:"id"`
+	Status    string          `json:"status" default:"stopped"`
+	Cycles    int             `json:"cycles" default:"0"`
+	Processes EngineProcesses `json:"processes"`
 }
 
 type EngineProcesses struct {
-	Pending     EngineProcessType `default:"{\"name\": \"Pending\"}"`
-	Update      EngineProcessType `default:"{\"name\": \"Update\"}"`
-	Maintenance EngineProcessType `default:"{\"name\": \"Maintenance\"}"`
+	Pending     EngineProcessType `json:"pending" default:"{\"name\": \"Pending\"}"`
+	Update      EngineProcessType `json:"update" default:"{\"name\": \"Update\"}"`
+	Maintenance EngineProcessType `json:"maintenance" default:"{\"name\": \"Maintenance\"}"`
 }
 
 type EngineProcessType struct {
-	Name    string    `default:"Unknown"`
-	LastRun time.Time `default:"time.Now()"`
-	Count   EngineProcessTypeCounts
+	Name    string                      `json:"name" default:"Unknown"`
+	LastRun time.Time                   `json:"lastRun" default:"time.Now()"`
+	Count   EngineProcessTypeCounts     `json:"count"`
+	Queries map[string]EngineQueryStats `json:"queries"`
+}
+
+type EngineQueryStats struct {
+	LastRun    time.Time `json:"lastRun"`
+	LastError  string    `json:"lastError"`
+	Failed     int       `json:"failed"`
+	Successful int       `json:"successful"`
+	Total      int       `json:"total"`
+	TimedOut   int       `json:"timedOut"`
 }
 
 type EngineProcessTypeCounts struct {
-	Failed     int `default:"0"`
-	Successful int `default:"0"`
-	Total      int `default:"0"`
-	Blacklist  []string
+	Failed     int      `json:"failed" default:"0"`
+	Successful int      `json:"successful" default:"0"`
+	Total      int      `json:"total" default:"0"`
+	TimedOut   int      `json:"timedOut" default:"0"`
+	Blacklist  []string `json:"blacklist"`
+}
+
+type EngineJob struct {
+	Queue     string    `json:"queue"`
+	Signature string    `json:"signature"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Thread    string    `json:"thread"`
+	Pid       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	Elapsed   float64   `json:"elapsed"`
+}
+
+type EngineQuarantinedJob struct {
+	Queue         string `json:"queue"`
+	Signature     string `json:"signature"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Failures      int    `json:"failures"`
+	LastError     string `json:"lastError"`
+	QuarantinedAt string `json:"quarantinedAt"`
+	ReleaseAt     string `json:"releaseAt"`
 }
 
 /************ Engine Threads ************/
 
 type EngineThreads struct {
-	Max         int `default:"0"`
-	Used        int `default:"0"`
-	Pending     EngineThreadsProcessTypeStat
-	Update      EngineThreadsProcessTypeStat
-	Maintenance EngineThreadsProcessTypeStat
+	Max         int                          `json:"max" default:"0"`
+	Used        int                          `json:"used" default:"0"`
+	Pending     EngineThreadsProcessTypeStat `json:"pending"`
+	Update      EngineThreadsProcessTypeStat `json:"update"`
+	Maintenance EngineThreadsProcessTypeStat `json:"maintenance"`
 }
 
 type EngineThreadsProcessType struct {
@@ -98,22 +299,66 @@ type EngineThreadsProcessType struct {
 }
 
 type EngineThreadsProcessTypeStat struct {
-	Max        int `default:"0"`
-	Used       int `default:"0"`
-	Percentage int `default:"0"`
+	Max        int `json:"max" default:"0"`
+	Used       int `json:"used" default:"0"`
+	Percentage int `json:"percentage" default:"0"`
+}
+
+/************ Api ************/
+
+type ApiStatus struct {
+	Engine   Engine          `json:"engine"`
+	Threads  EngineThreads   `json:"threads"`
+	Paused   map[string]bool `json:"paused"`
+	Draining bool            `json:"draining"`
+	Running  int             `json:"running"`
+}
+
+/************ Database ************/
+
+type DatabaseMigration struct {
+	Version   int
+	Name      string
+	Up        string
+	Down      string
+	AppliedAt string
 }
 
 /************ SQL Tables ************/
 
+// Columns of the queue table, tags hold the default column names which can be remapped per queue ("worker.queues")
 type TblCRQueryQueue struct {
 	PkQueryQueueID int    `TbField:"pkQueryQueueID"`
 	RunStatus      string `TbField:"runStatus"`
 	RunError       string `TbField:"runError"`
 	RunTime        int    `TbField:"runTime"`
+	RunTimeout     int    `TbField:"runTimeout"`
 	RunRepeat      string `TbField:"runRepeat"`
 	RunFirst       string `TbField:"runFirst"`
 	RunLast        string `TbField:"runLast"`
 	RunNext        string `TbField:"runNext"`
 	QueryName      string `TbField:"queryName"`
 	QuerySignature string `TbField:"querySignature"`
+	ClaimedBy      string `TbField:"claimedBy"`
+	ClaimedAt      string `TbField:"claimedAt"`
+	LeaseExpires   string `TbField:"leaseExpires"`
+	Recoveries     int    `TbField:"recoveries"`
+	Attempts       int    `TbField:"attempts"`
+	Priority       int    `TbField:"priority"`
+}
+
+type TblCRQueryQueueRun struct {
+	PkQueryQueueRunID int    `TbField:"pkQueryQueueRunID"`
+	QueueName         string `TbField:"queueName"`
+	QuerySignature    string `TbField:"querySignature"`
+	QueryName         string `TbField:"queryName"`
+	ProcessType       string `TbField:"processType"`
+	WorkerId          string `TbField:"workerId"`
+	ThreadId          int    `TbField:"threadId"`
+	RunStatus         string `TbField:"runStatus"`
+	ExitCode          int    `TbField:"exitCode"`
+	StartedAt         string `TbField:"startedAt"`
+	EndedAt           string `TbField:"endedAt"`
+	DurationMs        int    `TbField:"durationMs"`
+	Output            string `TbField:"output"`
 }
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"query-queue-worker/log"
+	"unicode/utf8"
 )
 
 // Reads JSON file into variable
@@ -43,6 +44,11 @@ func Die(msg string, params ...string) {
 	for _, param := range params {
 		error = fmt.Sprintf(error, param)
 	}
+	// Logger is not available until the config is loaded
+	if log.Writer == nil {
+		fmt.Fprint(os.Stderr, error)
+		Exit(1)
+	}
 	log.Writer.Error(error)
 	Exit(1)
 }
@@ -52,7 +58,7 @@ func Die(msg string, params ...string) {
 // Parameters:
 //   - data (...interface{}) : Any type data that will be printed on stdout
 func Debug(data ...interface{}) {
-	debugger.Print(data)
+	debugger.Print(data...)
 	Exit(1)
 }
 
@@ -66,3 +72,19 @@ func Exit(code int) {
 	// Exit
 	os.Exit(code)
 }
+
+// Returns the last bytes of a text, without starting on the middle of a multi-byte character
+//
+// Parameters:
+//   - text (string) : Text to truncate
+//   - length (int) : Maximum length in bytes
+func Tail(text string, length int) string {
+	if len(text) <= length {
+		return text
+	}
+	text = text[len(text)-length:]
+	for len(text) > 0 && !utf8.RuneStart(text[0]) {
+		text = text[1:]
+	}
+	return text
+}